@@ -0,0 +1,137 @@
+package bookshop
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	rand "github.com/brianvoe/gofakeit/v6"
+)
+
+const txnTransfer = "transfer"
+
+// DefaultVerifyInterval is the default interval of checking the total balance
+// in the bank scenario.
+const DefaultVerifyInterval = time.Second
+
+// BalanceViolation is a check whose total balance differs from the first one.
+type BalanceViolation struct {
+	CheckedAt time.Time
+	// SnapshotTS is the start ts of the checking transaction on TiDB, which is
+	// empty on the other databases.
+	SnapshotTS string
+	Expected   string
+	Actual     string
+}
+
+// BalanceCheck is the result of the checks of the total balance.
+type BalanceCheck struct {
+	Checks     int
+	Failures   int
+	Expected   string
+	Violations []BalanceViolation
+}
+
+// transfer moves some balance from a user to another, the rows are locked in
+// the order of the ids to avoid the deadlocks.
+func (w *Workloader) transfer(ctx context.Context, s *bookState) error {
+	from, to := w.randomUserID(s), w.randomUserID(s)
+	if from == to {
+		return nil
+	}
+	// The amount is passed as a decimal string to keep the balances exact.
+	amount := fmt.Sprintf("%d.%02d", rand.IntRange(0, 99), rand.IntRange(1, 99))
+
+	return w.retryConflicts(ctx, s, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx,
+			"SELECT id FROM users WHERE id IN (?, ?) ORDER BY id FOR UPDATE", from, to)
+		if err != nil {
+			return err
+		}
+		locked := 0
+		for rows.Next() {
+			locked++
+		}
+		_ = rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if locked != 2 {
+			// One of the users has been deleted.
+			return nil
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE users SET balance = balance - ? WHERE id = ?", amount, from); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE users SET balance = balance + ? WHERE id = ?", amount, to)
+		return err
+	})
+}
+
+// VerifyBalances checks the total balance of the users in a snapshot every
+// VerifyInterval until the context is done. The total of the first check is
+// expected in all the later checks, since the transfers never change it.
+func (w *Workloader) VerifyBalances(ctx context.Context) *BalanceCheck {
+	interval := w.cfg.VerifyInterval
+	if interval <= 0 {
+		interval = DefaultVerifyInterval
+	}
+
+	check := &BalanceCheck{}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		checkedAt := time.Now()
+		total, ts, err := w.totalBalance(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return check
+		case err != nil:
+			check.Failures++
+			w.log.WithError(err).Warn("failed to check the total balance")
+		case check.Checks == 0:
+			check.Checks++
+			check.Expected = total
+			w.log.Infof("The total balance of the users is %s.", total)
+		default:
+			check.Checks++
+			if total != check.Expected {
+				v := BalanceViolation{CheckedAt: checkedAt, SnapshotTS: ts, Expected: check.Expected, Actual: total}
+				check.Violations = append(check.Violations, v)
+				w.log.Errorf("The total balance is %s at %s (snapshot ts %s), but expected %s!",
+					total, checkedAt.Format(time.RFC3339Nano), ts, check.Expected)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return check
+		case <-ticker.C:
+		}
+	}
+}
+
+// totalBalance returns the total balance of the users and the start ts of the
+// snapshot on TiDB.
+func (w *Workloader) totalBalance(ctx context.Context) (string, string, error) {
+	tx, err := w.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return "", "", err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var total sql.NullString
+	if err := tx.QueryRowContext(ctx, "SELECT SUM(balance) FROM users").Scan(&total); err != nil {
+		return "", "", err
+	}
+
+	// The variable only exists on TiDB.
+	var ts sql.NullString
+	_ = tx.QueryRowContext(ctx, "SELECT @@tidb_current_ts").Scan(&ts)
+
+	return total.String, ts.String, nil
+}
@@ -3,7 +3,9 @@ package bookshop
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	"github.com/Mini256/tidb-dataset/pkg/db"
 	"github.com/sirupsen/logrus"
 )
 
@@ -16,58 +18,172 @@ const (
 	tableRatings     = "ratings"
 )
 
+// tableNames lists the tables with the child tables in front of their parent
+// tables, which is the safe order to truncate or drop them.
 var tableNames = []string{
 	tableOrders, tableRatings, tableBookAuthors, tableAuthors,
 	tableUsers, tableBooks,
 }
 
+// Tables returns the names of the tables, with the parent tables in front of
+// their child tables.
+func Tables() []string {
+	tables := make([]string, 0, len(tableNames))
+	for i := len(tableNames) - 1; i >= 0; i-- {
+		tables = append(tables, tableNames[i])
+	}
+	return tables
+}
+
+// isTableName tells whether the name is one of the tables.
+func isTableName(name string) bool {
+	for _, tableName := range tableNames {
+		if name == tableName {
+			return true
+		}
+	}
+	return false
+}
+
+// foreignKeys is the foreign key constraints of the child tables, which are
+// only created when the foreign keys schema variant is enabled.
+var foreignKeys = map[string][]string{
+	tableBookAuthors: {
+		"CONSTRAINT fk_book_authors_book_id FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE",
+		"CONSTRAINT fk_book_authors_author_id FOREIGN KEY (author_id) REFERENCES authors (id) ON DELETE CASCADE",
+	},
+	tableOrders: {
+		"CONSTRAINT fk_orders_book_id FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE RESTRICT",
+		"CONSTRAINT fk_orders_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE",
+	},
+	tableRatings: {
+		"CONSTRAINT fk_ratings_book_id FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE",
+		"CONSTRAINT fk_ratings_user_id FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE",
+	},
+}
+
+// defaultShardRowIDBits is the shard bits of the hidden row id used by the
+// nonclustered+shard_row_id_bits primary key strategy.
+const defaultShardRowIDBits = 4
+
 type ddlManager struct {
 	log *logrus.Entry
+	cfg Config
+
+	// script receives the statements instead of the database if it is set.
+	script *db.ScriptWriter
 }
 
-func newDDLManager(log *logrus.Entry) *ddlManager {
+func newDDLManager(log *logrus.Entry, cfg Config, script *db.ScriptWriter) *ddlManager {
 	return &ddlManager{
-		log: log,
+		log:    log,
+		cfg:    cfg,
+		script: script,
 	}
 }
 
 func (w *ddlManager) execTableDDL(ctx context.Context, query string) error {
-	s := getBookState(ctx)
-	if _, err := s.Conn.ExecContext(ctx, query); err != nil {
+	if w.script != nil {
+		return w.script.WriteStatement(query)
+	}
+	s, err := getBookState(ctx)
+	if err != nil {
 		return err
 	}
+	if _, err := s.Conn.ExecContext(ctx, query); err != nil {
+		return &SchemaError{Err: err}
+	}
 	return nil
 }
 
+// foreignKeyClause returns the foreign key definitions of the table, which
+// is appended to the end of the column and index definitions.
+func (w *ddlManager) foreignKeyClause(tableName string) string {
+	if !w.cfg.ForeignKeys || len(foreignKeys[tableName]) == 0 {
+		return ""
+	}
+	return ",\n\t\t\t" + strings.Join(foreignKeys[tableName], ",\n\t\t\t")
+}
+
+// idColumnDef returns the definition of the id column for the tables whose
+// primary key is a single id column.
+func (w *ddlManager) idColumnDef() string {
+	switch w.cfg.PKStrategy {
+	case PKAutoIncrement, PKShardRowIDBits:
+		return "id bigint(20) NOT NULL AUTO_INCREMENT"
+	case PKAutoRandom:
+		return "id bigint(20) NOT NULL AUTO_RANDOM"
+	default:
+		return "id bigint(20) NOT NULL"
+	}
+}
+
+// primaryKeyDef returns the definition of the primary key led by the id column,
+// clustered tells whether the table uses a clustered index by default.
+func (w *ddlManager) primaryKeyDef(tableName string, clustered bool) string {
+	switch w.cfg.PKStrategy {
+	case PKAutoRandom:
+		// AUTO_RANDOM is only allowed on the clustered primary key.
+		clustered = true
+	case PKShardRowIDBits:
+		// The rows are scattered by the hidden row id of the nonclustered table.
+		clustered = false
+	}
+
+	columns := w.keyColumns(tableName, "id")
+	if clustered {
+		return fmt.Sprintf("PRIMARY KEY (%s) /*T![clustered_index] CLUSTERED */", columns)
+	}
+	return fmt.Sprintf("PRIMARY KEY (%s) /*T![clustered_index] NONCLUSTERED */", columns)
+}
+
+// tableOptions returns the extra table options for the tables whose primary
+// key is a single id column.
+func (w *ddlManager) tableOptions() string {
+	if w.cfg.PKStrategy == PKShardRowIDBits {
+		return fmt.Sprintf(" /*T! SHARD_ROW_ID_BITS=%d */", defaultShardRowIDBits)
+	}
+	return ""
+}
+
+// setForeignKeyChecks turns on or off the foreign key checks of the DDL session.
+func (w *ddlManager) setForeignKeyChecks(ctx context.Context, enabled bool) error {
+	value := 0
+	if enabled {
+		value = 1
+	}
+	return w.execTableDDL(ctx, fmt.Sprintf("SET FOREIGN_KEY_CHECKS = %d;", value))
+}
+
 // createTables creates tables schema.
 func (w *ddlManager) createTables(ctx context.Context) error {
 	// Books.
-	query := `
+	query := fmt.Sprintf(`
 		CREATE TABLE IF NOT EXISTS books (
-			id bigint(20) NOT NULL,
+			%s,
 			title varchar(100) NOT NULL,
 			type enum('Magazine', 'Novel', 'Life', 'Arts', 'Comics', 'Education & Reference', 
 				'Humanities & Social Sciences', 'Science & Technology', 'Kids', 'Sports') NOT NULL,
 			published_at datetime NOT NULL,
 			stock int(11) DEFAULT '0',
 			price decimal(15,2) DEFAULT '0.0',
-			PRIMARY KEY (id) /*T![clustered_index] CLUSTERED */
-		) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
-	`
+			%s
+		) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin%s;
+	`, w.idColumnDef(), w.primaryKeyDef(tableBooks, true), w.tableOptions())
 	w.log.Printf("Creating table %s.\n", tableBooks)
 	if err := w.execTableDDL(ctx, query); err != nil {
 		return err
 	}
 
 	// Users.
-	query = `
+	query = fmt.Sprintf(`
 		CREATE TABLE IF NOT EXISTS users (
-			id bigint NOT NULL,
+			%s,
 			balance decimal(15,2) DEFAULT '0.0',
 			nickname varchar(100) UNIQUE NOT NULL,
-			PRIMARY KEY (id) /*T![clustered_index] NONCLUSTERED */
-		) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
-	`
+			%s
+		) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin%s;
+	`, w.idColumnDef(), w.primaryKeyDef(tableUsers, false), w.tableOptions())
 
 	w.log.Printf("Creating table %s.\n", tableUsers)
 	if err := w.execTableDDL(ctx, query); err != nil {
@@ -75,16 +191,16 @@ func (w *ddlManager) createTables(ctx context.Context) error {
 	}
 
 	// Authors.
-	query = `
+	query = fmt.Sprintf(`
 		CREATE TABLE IF NOT EXISTS authors (
-			id bigint(20) NOT NULL,
+			%s,
 			name varchar(100) NOT NULL,
 			gender tinyint(1) DEFAULT NULL,
 			birth_year smallint(6) DEFAULT NULL,
 			death_year smallint(6) DEFAULT NULL,
-			PRIMARY KEY (id) /*T![clustered_index] CLUSTERED */
-		) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
-	`
+			%s
+		) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin%s;
+	`, w.idColumnDef(), w.primaryKeyDef(tableAuthors, true), w.tableOptions())
 
 	w.log.Printf("Creating table %s.\n", tableAuthors)
 	if err := w.execTableDDL(ctx, query); err != nil {
@@ -92,13 +208,13 @@ func (w *ddlManager) createTables(ctx context.Context) error {
 	}
 
 	// Book Authors.
-	query = `
+	query = fmt.Sprintf(`
 		CREATE TABLE IF NOT EXISTS book_authors (
 			book_id bigint(20) NOT NULL,
 			author_id bigint(20) NOT NULL,
-			PRIMARY KEY (book_id, author_id) /*T![clustered_index] CLUSTERED */
+			PRIMARY KEY (book_id, author_id) /*T![clustered_index] CLUSTERED */%s
 		) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
-	`
+	`, w.foreignKeyClause(tableBookAuthors))
 
 	w.log.Printf("Creating table %s.\n", tableBookAuthors)
 	if err := w.execTableDDL(ctx, query); err != nil {
@@ -106,17 +222,18 @@ func (w *ddlManager) createTables(ctx context.Context) error {
 	}
 
 	// Orders.
-	query = `
+	query = fmt.Sprintf(`
 		CREATE TABLE IF NOT EXISTS orders (
-			id bigint(20) NOT NULL,
+			%s,
 			book_id bigint(20) NOT NULL,
 			user_id bigint(20) NOT NULL,
 			quality tinyint(4) NOT NULL,
 			ordered_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-			PRIMARY KEY (id) /*T![clustered_index] CLUSTERED */,
-			KEY orders_book_id_idx (book_id)
-		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
-	`
+			%s,
+			KEY orders_book_id_idx (book_id)%s%s
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin%s%s;
+	`, w.idColumnDef(), w.primaryKeyDef(tableOrders, true), w.globalIndexDef(tableOrders),
+		w.foreignKeyClause(tableOrders), w.tableOptions(), w.partitionClause(tableOrders))
 
 	w.log.Printf("Creating table %s.\n", tableOrders)
 	if err := w.execTableDDL(ctx, query); err != nil {
@@ -124,16 +241,17 @@ func (w *ddlManager) createTables(ctx context.Context) error {
 	}
 
 	// Ratings.
-	query = `
+	query = fmt.Sprintf(`
 	CREATE TABLE IF NOT EXISTS ratings (
 		book_id bigint NOT NULL,
 		user_id bigint NOT NULL,
 		score tinyint NOT NULL,
 		rated_at datetime NOT NULL DEFAULT NOW() ON UPDATE NOW(),
-		PRIMARY KEY (book_id, user_id) /*T![clustered_index] CLUSTERED */,
-		UNIQUE KEY uniq_book_user_idx (book_id, user_id)
-	) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
-	`
+		PRIMARY KEY (%s) /*T![clustered_index] CLUSTERED */,
+		UNIQUE KEY uniq_book_user_idx (%s)%s
+	) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin%s;
+	`, w.keyColumns(tableRatings, "book_id", "user_id"), w.keyColumns(tableRatings, "book_id", "user_id"),
+		w.foreignKeyClause(tableRatings), w.partitionClause(tableRatings))
 
 	w.log.Printf("Creating table %s.\n", tableRatings)
 	if err := w.execTableDDL(ctx, query); err != nil {
@@ -145,13 +263,15 @@ func (w *ddlManager) createTables(ctx context.Context) error {
 	return nil
 }
 
-// dropTables creates tables schema.
+// dropTables drops tables schema.
 func (w *ddlManager) dropTables(ctx context.Context) error {
-	dropTables := []string{
-		tableOrders, tableRatings, tableBookAuthors, tableAuthors, tableUsers, tableBooks,
+	// The tables may be created with foreign keys by the previous prepare,
+	// so disable the checks in case the parent tables are referenced.
+	if err := w.setForeignKeyChecks(ctx, false); err != nil {
+		return err
 	}
 
-	for _, tableName := range dropTables {
+	for _, tableName := range tableNames {
 		query := fmt.Sprintf("DROP TABLE IF EXISTS %s;", tableName)
 		w.log.Printf("Dropping table %s.\n", tableName)
 		if err := w.execTableDDL(ctx, query); err != nil {
@@ -159,5 +279,23 @@ func (w *ddlManager) dropTables(ctx context.Context) error {
 		}
 	}
 
-	return nil
+	return w.setForeignKeyChecks(ctx, true)
+}
+
+// truncateTables clears the data of the tables.
+func (w *ddlManager) truncateTables(ctx context.Context) error {
+	// TRUNCATE TABLE is rejected on the parent tables referenced by foreign
+	// keys, no matter whether the child tables are empty.
+	if err := w.setForeignKeyChecks(ctx, false); err != nil {
+		return err
+	}
+
+	for _, tableName := range tableNames {
+		query := fmt.Sprintf("TRUNCATE TABLE %s;", tableName)
+		if err := w.execTableDDL(ctx, query); err != nil {
+			return err
+		}
+	}
+
+	return w.setForeignKeyChecks(ctx, true)
 }
@@ -0,0 +1,35 @@
+package bookshop
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Mini256/tidb-dataset/pkg/db"
+)
+
+// errNoThreadState is returned when the context is not initialized by
+// InitThread.
+var errNoThreadState = errors.New("the thread state is not found, the context must be initialized by InitThread")
+
+// SchemaError is a failure of creating, altering or dropping the tables.
+type SchemaError struct {
+	Err error
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("failed to change the schema: %v", e.Err)
+}
+
+func (e *SchemaError) Unwrap() error {
+	return e.Err
+}
+
+// loadError returns the load error of the table, the error already holding
+// the table is kept as it is.
+func loadError(tableName string, err error) error {
+	var loadErr *db.LoadError
+	if errors.As(err, &loadErr) {
+		return err
+	}
+	return &db.LoadError{Table: tableName, Err: err}
+}
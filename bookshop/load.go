@@ -4,10 +4,8 @@ import (
 	"context"
 	"fmt"
 	"math"
-	"strings"
 	"time"
 
-	"github.com/Mini256/tidb-dataset/pkg/db"
 	"github.com/Mini256/tidb-dataset/pkg/util"
 	rand "github.com/brianvoe/gofakeit/v6"
 )
@@ -20,7 +18,16 @@ const (
 	DefaultRatingCount = 300000
 )
 
-const MySQLDateTimeValue = "2006-01-02 03:04:05"
+const MySQLDateTimeValue = "2006-01-02 15:04:05"
+
+// dataTimeStart is the earliest time of the generated orders and ratings.
+var dataTimeStart = time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// The range of the random ids generated by the client-random strategy.
+const (
+	minRandomID = 1000
+	maxRandomID = math.MaxUint32
+)
 
 var bookTypes = []string{
 	"Magazine",
@@ -35,70 +42,120 @@ var bookTypes = []string{
 	"Sports",
 }
 
-func (w *Workloader) loadUsers(ctx context.Context) (util.UInt32, error) {
-	dml := "INSERT INTO users (id, nickname, balance) VALUES "
-	bl := db.NewSQLBatchLoader(w.db, dml, 3, 10)
+// newID returns a new unique random id and records it in the ids, or zero
+// if the ids are assigned by the server.
+func (w *Workloader) newID(ids util.Int64) int64 {
+	if w.cfg.PKStrategy.ServerAssignedID() {
+		return 0
+	}
 
-	userIDs := make(util.UInt32)
-	userNicknames := make(util.String)
+	for {
+		id := int64(rand.UintRange(minRandomID, maxRandomID))
+		if _, ok := ids[id]; !ok {
+			ids[id] = struct{}{}
+			return id
+		}
+	}
+}
 
-	for w.cfg.UserCount > 0 && len(userIDs) < w.cfg.UserCount {
-		userID := uint32(rand.UintRange(1000, math.MaxInt))
-		if _, ok := userIDs[userID]; ok {
-			continue
+// loadTables loads the tables with the rows generated from the seed.
+func (w *Workloader) loadTables(ctx context.Context) error {
+	rand.Seed(w.cfg.Seed)
+	w.dataTimeEnd = time.Now().UTC().Truncate(24 * time.Hour)
+	return prepareWorkload(ctx, w.log, w)
+}
+
+// loadedIDs returns the ids of the loaded table, the ids assigned by the
+// server are queried back so that the dependent tables can refer to them.
+func (w *Workloader) loadedIDs(ctx context.Context, tableName string, ids util.Int64, count int) (util.Int64, error) {
+	if !w.cfg.PKStrategy.ServerAssignedID() {
+		return ids, nil
+	}
+	if w.db == nil {
+		// The ids are assigned from 1 in the new tables.
+		for id := int64(1); id <= int64(count); id++ {
+			ids[id] = struct{}{}
 		}
-		userIDs[userID] = struct{}{}
+		return ids, nil
+	}
 
+	rows, err := w.db.QueryContext(ctx, fmt.Sprintf("SELECT id FROM %s", tableName))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = struct{}{}
+	}
+
+	return ids, rows.Err()
+}
+
+func (w *Workloader) loadUsers(ctx context.Context) (util.Int64, error) {
+	rw, err := w.newRowWriter(tableUsers)
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := make(util.Int64)
+	userNicknames := make(util.String)
+
+	for w.cfg.UserCount > 0 && len(userNicknames) < w.cfg.UserCount {
 		nickname := rand.Username()
 		if _, ok := userNicknames[nickname]; ok {
 			continue
 		}
 		userNicknames[nickname] = struct{}{}
 
+		userID := w.newID(userIDs)
 		balance := rand.Float64Range(100, 10000)
 
-		v := []string{fmt.Sprintf(`(%d, '%s', %f)`, userID, nickname, balance)}
-		if err := bl.InsertValue(ctx, v); err != nil {
+		if err := rw.WriteRow(ctx, []interface{}{userID, nickname, balance}); err != nil {
 			return nil, err
 		}
 	}
 
-	return userIDs, bl.Flush(ctx)
-}
+	if err := rw.Close(ctx); err != nil {
+		return nil, err
+	}
 
-func (w *Workloader) loadBooks(ctx context.Context) (util.UInt32, error) {
-	bookSQL := "INSERT INTO books (id, title, type, published_at, stock, price) VALUES "
-	bookBL := db.NewSQLBatchLoader(w.db, bookSQL, 3, 10)
-	bookIDs := make(util.UInt32)
+	return w.loadedIDs(ctx, tableUsers, userIDs, len(userNicknames))
+}
 
-	for w.cfg.BookCount > 0 && len(bookIDs) < w.cfg.BookCount {
-		bookID := uint32(rand.UintRange(1000, math.MaxInt))
-		if _, ok := bookIDs[bookID]; ok {
-			continue
-		}
-		bookIDs[bookID] = struct{}{}
+func (w *Workloader) loadBooks(ctx context.Context) (util.Int64, error) {
+	bookRW, err := w.newRowWriter(tableBooks)
+	if err != nil {
+		return nil, err
+	}
+	bookIDs := make(util.Int64)
 
+	for i := 0; i < w.cfg.BookCount; i++ {
+		bookID := w.newID(bookIDs)
 		bookType := rand.RandomString(bookTypes)
 		bookTitle := getBookTitle(bookType)
 		bookReleaseTime := rand.DateRange(
 			time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC),
-			time.Date(time.Now().Year(), 12, 31, 0, 0, 0, 0, time.UTC),
+			time.Date(w.dataTimeEnd.Year(), 12, 31, 0, 0, 0, 0, time.UTC),
 		)
 		stock := rand.IntRange(10, 1000)
 		price := rand.Float64Range(10, 500)
 
-		v := []string{
-			fmt.Sprintf(
-				`(%d, '%s', '%s', '%s', %d, %f)`,
-				bookID, bookTitle, bookType, bookReleaseTime.Format(MySQLDateTimeValue), stock, price,
-			),
-		}
-		if err := bookBL.InsertValue(ctx, v); err != nil {
+		row := []interface{}{bookID, bookTitle, bookType, bookReleaseTime, stock, price}
+		if err := bookRW.WriteRow(ctx, row); err != nil {
 			return nil, err
 		}
 	}
 
-	return bookIDs, bookBL.Flush(ctx)
+	if err := bookRW.Close(ctx); err != nil {
+		return nil, err
+	}
+
+	return w.loadedIDs(ctx, tableBooks, bookIDs, w.cfg.BookCount)
 }
 
 func getBookTitle(bookType string) string {
@@ -115,118 +172,115 @@ func getBookTitle(bookType string) string {
 	default:
 		bookTitle = rand.Name()
 	}
-	return strings.ReplaceAll(bookTitle, "'", "\\'")
+	return bookTitle
 }
 
-func (w *Workloader) loadAuthors(ctx context.Context) (util.UInt32, error) {
-	dml := "INSERT INTO authors (id, name, gender, birth_year, death_year) VALUES "
-	bl := db.NewSQLBatchLoader(w.db, dml, 3, 10)
-	authorIDs := make(util.UInt32)
-
-	for w.cfg.AuthorCount > 0 && len(authorIDs) < w.cfg.AuthorCount {
-		authorID := uint32(rand.UintRange(1000, math.MaxInt))
-
-		if _, exists := authorIDs[authorID]; exists {
-			continue
-		}
-		authorIDs[authorID] = struct{}{}
+func (w *Workloader) loadAuthors(ctx context.Context) (util.Int64, error) {
+	rw, err := w.newRowWriter(tableAuthors)
+	if err != nil {
+		return nil, err
+	}
+	authorIDs := make(util.Int64)
 
+	for i := 0; i < w.cfg.AuthorCount; i++ {
+		authorID := w.newID(authorIDs)
 		name := rand.Name()
 		gender := rand.IntRange(0, 1) // 0: female, 1: male
 		birthYear := rand.IntRange(1930, 2000)
 		age := rand.IntRange(0, 80)
 
-		var v []string
-		deathYear := birthYear + age
-		if deathYear <= time.Now().Year() {
-			v = append(v, fmt.Sprintf(`(%d, '%s', %d, %d, %d)`, authorID, name, gender, birthYear, deathYear))
-		} else {
-			v = append(v, fmt.Sprintf(`(%d, '%s', %d, %d, null)`, authorID, name, gender, birthYear))
+		var deathYear interface{}
+		if birthYear+age <= w.dataTimeEnd.Year() {
+			deathYear = birthYear + age
 		}
 
-		if err := bl.InsertValue(ctx, v); err != nil {
+		if err := rw.WriteRow(ctx, []interface{}{authorID, name, gender, birthYear, deathYear}); err != nil {
 			return nil, err
 		}
 	}
 
-	return authorIDs, bl.Flush(ctx)
+	if err := rw.Close(ctx); err != nil {
+		return nil, err
+	}
+
+	return w.loadedIDs(ctx, tableAuthors, authorIDs, w.cfg.AuthorCount)
 }
 
-func (w *Workloader) loadBookAuthors(ctx context.Context, bookIDs, authorIds util.UInt32) error {
-	authorIDArr := util.UInt32Set2Arr(authorIds)
-	dml := "INSERT INTO book_authors (book_id, author_id) VALUES "
-	bl := db.NewSQLBatchLoader(w.db, dml, 3, 10)
+func (w *Workloader) loadBookAuthors(ctx context.Context, bookIDs, authorIds util.Int64) error {
+	if len(bookIDs) == 0 || len(authorIds) == 0 {
+		return nil
+	}
 
-	for bookID := range bookIDs {
+	authorIDArr := util.Int64Set2Arr(authorIds)
+	rw, err := w.newRowWriter(tableBookAuthors)
+	if err != nil {
+		return err
+	}
+
+	for _, bookID := range util.Int64Set2Arr(bookIDs) {
 		authorIndex := rand.IntRange(0, len(authorIds)-1)
-		authorID := authorIDArr[uint32(authorIndex)]
+		authorID := authorIDArr[authorIndex]
 
-		v := []string{fmt.Sprintf(`(%d, %d)`, bookID, authorID)}
-		if err := bl.InsertValue(ctx, v); err != nil {
+		if err := rw.WriteRow(ctx, []interface{}{bookID, authorID}); err != nil {
 			return err
 		}
 	}
 
-	return bl.Flush(ctx)
+	return rw.Close(ctx)
 }
 
-func (w *Workloader) loadOrders(ctx context.Context, userIDs, bookIDs util.UInt32) error {
+func (w *Workloader) loadOrders(ctx context.Context, userIDs, bookIDs util.Int64) error {
 	if len(userIDs) == 0 || len(bookIDs) == 0 {
 		return nil
 	}
 
-	dml := "INSERT INTO orders (id, book_id, user_id, quality, ordered_at) VALUES "
-	bl := db.NewSQLBatchLoader(w.db, dml, 3, 10)
-
-	userIDArr := util.UInt32Set2Arr(userIDs)
-	bookIDArr := util.UInt32Set2Arr(bookIDs)
+	rw, err := w.newRowWriter(tableOrders)
+	if err != nil {
+		return err
+	}
 
-	orderSet := make(util.UInt32)
-	for w.cfg.OrderCount > 0 && len(orderSet) < w.cfg.OrderCount {
-		orderID := uint32(rand.UintRange(1000, math.MaxInt))
-		if _, ok := orderSet[orderID]; ok {
-			continue
-		}
-		orderSet[orderID] = struct{}{}
+	userIDArr := util.Int64Set2Arr(userIDs)
+	bookIDArr := util.Int64Set2Arr(bookIDs)
 
-		bookIndex := uint32(rand.IntRange(0, len(bookIDs)-1))
+	orderSet := make(util.Int64)
+	for i := 0; i < w.cfg.OrderCount; i++ {
+		orderID := w.newID(orderSet)
+		bookIndex := rand.IntRange(0, len(bookIDs)-1)
 		bookID := bookIDArr[bookIndex]
-		userIndex := uint32(rand.IntRange(0, len(userIDs)-1))
+		userIndex := rand.IntRange(0, len(userIDs)-1)
 		userID := userIDArr[userIndex]
 		quality := rand.IntRange(1, 10)
 		orderedAt := rand.DateRange(
-			time.Date(2010, 0, 0, 0, 0, 0, 0, time.UTC),
-			time.Now(),
+			dataTimeStart,
+			w.dataTimeEnd,
 		)
 
-		v := []string{
-			fmt.Sprintf(`(%d, %d, %d, %d, '%s')`,
-				orderID, bookID, userID, quality, orderedAt.Format(MySQLDateTimeValue)),
-		}
-		if err := bl.InsertValue(ctx, v); err != nil {
+		if err := rw.WriteRow(ctx, []interface{}{orderID, bookID, userID, quality, orderedAt}); err != nil {
 			return err
 		}
 	}
 
-	return bl.Flush(ctx)
+	return rw.Close(ctx)
 }
 
-func (w *Workloader) loadRatings(ctx context.Context, userIDs, bookIDs util.UInt32) error {
+func (w *Workloader) loadRatings(ctx context.Context, userIDs, bookIDs util.Int64) error {
 	if len(userIDs) == 0 || len(bookIDs) == 0 {
 		return nil
 	}
 
-	dml := "INSERT INTO ratings (book_id, user_id, score, rated_at) VALUES "
-	bl := db.NewSQLBatchLoader(w.db, dml, 3, 10)
+	rw, err := w.newRowWriter(tableRatings)
+	if err != nil {
+		return err
+	}
 
-	userIDArr := util.UInt32Set2Arr(userIDs)
-	bookIDArr := util.UInt32Set2Arr(bookIDs)
+	userIDArr := util.Int64Set2Arr(userIDs)
+	bookIDArr := util.Int64Set2Arr(bookIDs)
 
 	ratingSet := make(util.String)
 	for w.cfg.RatingCount > 0 && len(ratingSet) < w.cfg.RatingCount {
-		bookIndex := uint32(rand.IntRange(0, len(bookIDs)-1))
+		bookIndex := rand.IntRange(0, len(bookIDs)-1)
 		bookID := bookIDArr[bookIndex]
-		userIndex := uint32(rand.IntRange(0, len(userIDs)-1))
+		userIndex := rand.IntRange(0, len(userIDs)-1)
 		userID := userIDArr[userIndex]
 
 		key := fmt.Sprintf("%d-%d", bookID, userID)
@@ -237,20 +291,14 @@ func (w *Workloader) loadRatings(ctx context.Context, userIDs, bookIDs util.UInt
 
 		score := rand.IntRange(0, 5)
 		ratedAt := rand.DateRange(
-			time.Date(2010, 0, 0, 0, 0, 0, 0, time.UTC),
-			time.Now(),
+			dataTimeStart,
+			w.dataTimeEnd,
 		)
 
-		v := []string{
-			fmt.Sprintf(
-				`(%d, %d, %d, '%s')`,
-				bookID, userID, score, ratedAt.Format(MySQLDateTimeValue),
-			),
-		}
-		if err := bl.InsertValue(ctx, v); err != nil {
+		if err := rw.WriteRow(ctx, []interface{}{bookID, userID, score, ratedAt}); err != nil {
 			return err
 		}
 	}
 
-	return bl.Flush(ctx)
+	return rw.Close(ctx)
 }
@@ -0,0 +1,337 @@
+package bookshop
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PartitionKind is the partitioning method of a partitioned table.
+type PartitionKind string
+
+const (
+	// PartitionRangeMonth partitions the table by RANGE on the time column,
+	// one partition for each month.
+	PartitionRangeMonth PartitionKind = "range-month"
+	// PartitionHash partitions the table by HASH into a number of partitions.
+	PartitionHash PartitionKind = "hash"
+	// PartitionList partitions the table by LIST on a category column.
+	PartitionList PartitionKind = "list"
+)
+
+const (
+	// DefaultPartitionFutureMonths is the number of months created ahead of
+	// the current month for the range-month partitioned tables.
+	DefaultPartitionFutureMonths = 3
+
+	partitionNameLayout  = "p200601"
+	partitionValueLayout = "2006-01-02"
+)
+
+// PartitionSpec describes how a table is partitioned.
+type PartitionSpec struct {
+	Table string
+	Kind  PartitionKind
+	// Count is the number of partitions for the hash partitioned table.
+	Count int
+}
+
+// partitionColumns is the partitioning column of each partitionable table.
+// The ratings are only partitioned by the hash of book_id, because the other
+// partitioning columns would be added to the primary key (book_id, user_id),
+// which the upserts of the ratings rely on.
+var partitionColumns = map[string]map[PartitionKind]string{
+	tableOrders: {
+		PartitionRangeMonth: "ordered_at",
+		PartitionHash:       "id",
+		PartitionList:       "quality",
+	},
+	tableRatings: {
+		PartitionHash: "book_id",
+	},
+}
+
+// partitionLists is the partitions of the list partitioned tables.
+var partitionLists = map[string][]string{
+	tableOrders: {
+		"PARTITION p_small VALUES IN (1, 2, 3)",
+		"PARTITION p_medium VALUES IN (4, 5, 6, 7)",
+		"PARTITION p_large VALUES IN (8, 9, 10)",
+	},
+}
+
+// column returns the partitioning column of the table.
+func (p PartitionSpec) column() string {
+	return partitionColumns[p.Table][p.Kind]
+}
+
+func (p PartitionSpec) String() string {
+	if p.Kind == PartitionHash {
+		return fmt.Sprintf("%s:%s-%d", p.Table, p.Kind, p.Count)
+	}
+	return fmt.Sprintf("%s:%s", p.Table, p.Kind)
+}
+
+// PartitionSpecs is a list of partition specs, which can be used as the
+// value of a command line flag like "orders:range-month,ratings:hash-16".
+type PartitionSpecs []PartitionSpec
+
+func (ps *PartitionSpecs) String() string {
+	specs := make([]string, 0, len(*ps))
+	for _, p := range *ps {
+		specs = append(specs, p.String())
+	}
+	return strings.Join(specs, ",")
+}
+
+// Set parses the comma separated partition specs.
+func (ps *PartitionSpecs) Set(value string) error {
+	var specs PartitionSpecs
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		p, err := parsePartitionSpec(item)
+		if err != nil {
+			return err
+		}
+		for _, spec := range specs {
+			if spec.Table == p.Table {
+				return fmt.Errorf("table %s is partitioned more than once", p.Table)
+			}
+		}
+		specs = append(specs, p)
+	}
+	*ps = specs
+	return nil
+}
+
+func (ps *PartitionSpecs) Type() string {
+	return "partitions"
+}
+
+// get returns the partition spec of the table, or nil if it is not partitioned.
+func (ps PartitionSpecs) get(tableName string) *PartitionSpec {
+	for i := range ps {
+		if ps[i].Table == tableName {
+			return &ps[i]
+		}
+	}
+	return nil
+}
+
+func parsePartitionSpec(value string) (PartitionSpec, error) {
+	var p PartitionSpec
+
+	fields := strings.SplitN(value, ":", 2)
+	if len(fields) != 2 {
+		return p, fmt.Errorf("invalid partition spec %q, expect <table>:<method>", value)
+	}
+	p.Table = fields[0]
+	if _, ok := partitionColumns[p.Table]; !ok {
+		return p, fmt.Errorf("table %s can not be partitioned", p.Table)
+	}
+
+	method := fields[1]
+	switch {
+	case method == string(PartitionRangeMonth):
+		p.Kind = PartitionRangeMonth
+	case method == string(PartitionList):
+		p.Kind = PartitionList
+	case strings.HasPrefix(method, string(PartitionHash)+"-"):
+		count, err := strconv.Atoi(strings.TrimPrefix(method, string(PartitionHash)+"-"))
+		if err != nil || count <= 0 {
+			return p, fmt.Errorf("invalid partition number in partition spec %q", value)
+		}
+		p.Kind = PartitionHash
+		p.Count = count
+	default:
+		return p, fmt.Errorf("unknown partition method %q, available: range-month, hash-<n>, list", method)
+	}
+	if p.column() == "" {
+		return p, fmt.Errorf("table %s can not be partitioned by %s", p.Table, p.Kind)
+	}
+
+	return p, nil
+}
+
+// keyColumns returns the columns of the primary or unique key, the
+// partitioning column is appended if the table is partitioned by others,
+// because every unique key must include all the partitioning columns.
+func (w *ddlManager) keyColumns(tableName string, columns ...string) string {
+	if p := w.cfg.Partitions.get(tableName); p != nil {
+		col := p.column()
+		included := false
+		for _, c := range columns {
+			included = included || c == col
+		}
+		if !included {
+			columns = append(columns, col)
+		}
+	}
+	return strings.Join(columns, ", ")
+}
+
+// validateGlobalIndex checks that the orders are partitioned by a column other
+// than the id, or else the unique index on the id is a local one.
+func (cfg *Config) validateGlobalIndex() error {
+	if !cfg.GlobalIndex {
+		return nil
+	}
+	p := cfg.Partitions.get(tableOrders)
+	if p == nil {
+		return fmt.Errorf("global index requires the orders to be partitioned")
+	}
+	if p.column() == "id" {
+		return fmt.Errorf("global index requires the orders to be partitioned by a column other than id, got %s", p)
+	}
+	return nil
+}
+
+// globalIndexDef returns the definition of the global unique index on the id
+// of the table, which keeps the id unique across the partitions while the
+// primary key includes the partitioning column.
+func (w *ddlManager) globalIndexDef(tableName string) string {
+	if !w.cfg.GlobalIndex || w.cfg.Partitions.get(tableName) == nil {
+		return ""
+	}
+	return fmt.Sprintf(",\n\t\t\tUNIQUE KEY %s_id_global_idx (id) GLOBAL", tableName)
+}
+
+// partitionClause returns the partition options of the table.
+func (w *ddlManager) partitionClause(tableName string) string {
+	p := w.cfg.Partitions.get(tableName)
+	if p == nil {
+		return ""
+	}
+
+	var partitions []string
+	switch p.Kind {
+	case PartitionRangeMonth:
+		now := time.Now()
+		end := time.Date(now.Year(), now.Month()+time.Month(w.cfg.PartitionFutureMonths), 1, 0, 0, 0, 0, time.UTC)
+		for month := monthOf(dataTimeStart); !month.After(end); month = month.AddDate(0, 1, 0) {
+			partitions = append(partitions, monthPartitionDef(month))
+		}
+		return fmt.Sprintf("\n\t\tPARTITION BY RANGE COLUMNS (%s) (\n\t\t\t%s\n\t\t)",
+			p.column(), strings.Join(partitions, ",\n\t\t\t"))
+	case PartitionHash:
+		return fmt.Sprintf("\n\t\tPARTITION BY HASH (%s) PARTITIONS %d", p.column(), p.Count)
+	case PartitionList:
+		return fmt.Sprintf("\n\t\tPARTITION BY LIST (%s) (\n\t\t\t%s\n\t\t)",
+			p.column(), strings.Join(partitionLists[tableName], ",\n\t\t\t"))
+	}
+
+	return ""
+}
+
+// monthOf returns the first day of the month of the time.
+func monthOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// monthPartitionDef returns the definition of the partition holding the month.
+func monthPartitionDef(month time.Time) string {
+	return fmt.Sprintf("PARTITION %s VALUES LESS THAN ('%s')",
+		month.Format(partitionNameLayout), month.AddDate(0, 1, 0).Format(partitionValueLayout))
+}
+
+// RotatePartitions adds the partitions of the future months and drops the
+// partitions older than the retention months on the range-month partitioned
+// tables of a live dataset.
+func (w *Workloader) RotatePartitions(ctx context.Context) error {
+	s, err := getBookState(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	future := monthOf(now).AddDate(0, w.cfg.PartitionFutureMonths, 0)
+	var expired time.Time
+	if w.cfg.PartitionRetentionMonths > 0 {
+		expired = monthOf(now).AddDate(0, -w.cfg.PartitionRetentionMonths, 0)
+	}
+
+	for _, tableName := range []string{tableOrders} {
+		months, err := w.rangeMonthPartitions(ctx, tableName)
+		if err != nil {
+			return err
+		}
+		if len(months) == 0 {
+			w.log.Infof("Table %s is not partitioned by month, skipped.", tableName)
+			continue
+		}
+
+		var added []string
+		for month := months[len(months)-1].AddDate(0, 1, 0); !month.After(future); month = month.AddDate(0, 1, 0) {
+			added = append(added, monthPartitionDef(month))
+		}
+		if len(added) > 0 {
+			query := fmt.Sprintf("ALTER TABLE %s ADD PARTITION (%s);", tableName, strings.Join(added, ", "))
+			w.log.Infof("Adding %d partitions to table %s.", len(added), tableName)
+			if _, err := s.Conn.ExecContext(ctx, query); err != nil {
+				return &SchemaError{Err: err}
+			}
+		}
+
+		var dropped []string
+		for _, month := range months {
+			// Keep at least one partition, a table must have partitions.
+			if month.Before(expired) && len(dropped) < len(months)+len(added)-1 {
+				dropped = append(dropped, month.Format(partitionNameLayout))
+			}
+		}
+		if len(dropped) > 0 {
+			query := fmt.Sprintf("ALTER TABLE %s DROP PARTITION %s;", tableName, strings.Join(dropped, ", "))
+			w.log.Infof("Dropping %d partitions from table %s.", len(dropped), tableName)
+			if _, err := s.Conn.ExecContext(ctx, query); err != nil {
+				return &SchemaError{Err: err}
+			}
+		}
+	}
+
+	return nil
+}
+
+// rangeMonthPartitions returns the months of the range-month partitions of
+// the table in ascending order.
+func (w *Workloader) rangeMonthPartitions(ctx context.Context, tableName string) ([]time.Time, error) {
+	s, err := getBookState(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.Conn.QueryContext(ctx, `
+		SELECT partition_name FROM information_schema.partitions
+		WHERE table_schema = ? AND table_name = ? AND partition_method LIKE 'RANGE%'
+	`, w.cfg.DBName, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var months []time.Time
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		month, err := time.Parse(partitionNameLayout, name)
+		if err != nil {
+			return nil, fmt.Errorf("table %s has a partition %s not named by month", tableName, name)
+		}
+		months = append(months, month)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(months, func(i, j int) bool {
+		return months[i].Before(months[j])
+	})
+	return months, nil
+}
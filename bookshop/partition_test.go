@@ -0,0 +1,90 @@
+package bookshop
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPartitionSpecsSet(t *testing.T) {
+	tests := []struct {
+		value string
+		want  PartitionSpecs
+		err   bool
+	}{
+		{value: "", want: nil},
+		{value: "orders:range-month", want: PartitionSpecs{{Table: tableOrders, Kind: PartitionRangeMonth}}},
+		{value: "orders:list", want: PartitionSpecs{{Table: tableOrders, Kind: PartitionList}}},
+		{
+			value: " orders:hash-8 , ratings:hash-16 ,",
+			want: PartitionSpecs{
+				{Table: tableOrders, Kind: PartitionHash, Count: 8},
+				{Table: tableRatings, Kind: PartitionHash, Count: 16},
+			},
+		},
+		{value: "orders", err: true},
+		{value: "books:hash-4", err: true},
+		{value: "orders:hash", err: true},
+		{value: "orders:hash-0", err: true},
+		{value: "orders:hash-x", err: true},
+		{value: "orders:range-year", err: true},
+		{value: "ratings:range-month", err: true},
+		{value: "ratings:list", err: true},
+		{value: "orders:list,orders:hash-4", err: true},
+	}
+
+	for _, tt := range tests {
+		var ps PartitionSpecs
+		err := ps.Set(tt.value)
+		if tt.err {
+			if err == nil {
+				t.Errorf("Set(%q) = %v, want an error", tt.value, ps)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Set(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(ps, tt.want) {
+			t.Errorf("Set(%q) = %v, want %v", tt.value, ps, tt.want)
+		}
+	}
+}
+
+func TestGlobalIndex(t *testing.T) {
+	tests := []struct {
+		partitions string
+		global     bool
+		want       string
+		err        bool
+	}{
+		{partitions: "orders:range-month", want: ""},
+		{partitions: "orders:range-month", global: true, want: ",\n\t\t\tUNIQUE KEY orders_id_global_idx (id) GLOBAL"},
+		{partitions: "orders:list", global: true, want: ",\n\t\t\tUNIQUE KEY orders_id_global_idx (id) GLOBAL"},
+		{partitions: "orders:hash-8", global: true, err: true},
+		{partitions: "ratings:hash-16", global: true, err: true},
+		{partitions: "", global: true, err: true},
+	}
+
+	for _, tt := range tests {
+		cfg := Config{GlobalIndex: tt.global}
+		if err := cfg.Partitions.Set(tt.partitions); err != nil {
+			t.Fatal(err)
+		}
+		err := cfg.validateGlobalIndex()
+		if tt.err {
+			if err == nil {
+				t.Errorf("validateGlobalIndex(%q) succeeded, want an error", tt.partitions)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("validateGlobalIndex(%q) failed: %v", tt.partitions, err)
+			continue
+		}
+		w := &ddlManager{cfg: cfg}
+		if got := w.globalIndexDef(tableOrders); got != tt.want {
+			t.Errorf("globalIndexDef(%q) = %q, want %q", tt.partitions, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package bookshop
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Mini256/tidb-dataset/pkg/workload"
+)
+
+// DefaultProfile is the profile used by the run workload by default.
+const DefaultProfile = "mixed"
+
+// profiles is the built-in profiles of the run workload.
+var profiles = []workload.Profile{
+	{
+		Name:        DefaultProfile,
+		Description: "Balanced mix of browsing, ordering and rating",
+		Weights: map[string]int{
+			txnNewOrder: 30, txnRateBook: 15, txnViewBook: 40, txnUserOrders: 15,
+		},
+	},
+	{
+		Name:        "read-heavy",
+		Description: "Mostly browsing the books and orders, with popular books viewed more often",
+		Weights: map[string]int{
+			txnNewOrder: 5, txnRateBook: 5, txnViewBook: 60, txnUserOrders: 30,
+		},
+		Skew: 1.1,
+	},
+	{
+		Name:        "write-heavy",
+		Description: "Mostly placing orders and rating books",
+		Weights: map[string]int{
+			txnNewOrder: 50, txnRateBook: 40, txnViewBook: 5, txnUserOrders: 5,
+		},
+	},
+	{
+		Name:        "checkout-storm",
+		Description: "Flash sale where most of the orders go to a few hot books",
+		Weights: map[string]int{
+			txnNewOrder: 80, txnViewBook: 20,
+		},
+		Skew: 1.5,
+	},
+	{
+		Name:        "analytics-mixed",
+		Description: "Online transactions mixed with the sales reports of the recent orders",
+		Weights: map[string]int{
+			txnNewOrder: 20, txnViewBook: 40, txnUserOrders: 20, txnSalesReport: 20,
+		},
+		ThinkTime: 10 * time.Millisecond,
+	},
+}
+
+// Profiles returns the built-in profiles of the run workload.
+func Profiles() []workload.Profile {
+	return profiles
+}
+
+// Profiles implements Workloader interface.
+func (w *Workloader) Profiles() []workload.Profile {
+	return Profiles()
+}
+
+// loadProfile returns the profile by the name of a built-in profile or the
+// path of a custom YAML profile, and validates it.
+func (w *Workloader) loadProfile(nameOrPath string) (*workload.Profile, error) {
+	if nameOrPath == "" {
+		nameOrPath = DefaultProfile
+	}
+
+	var p *workload.Profile
+	for i := range profiles {
+		if profiles[i].Name == nameOrPath {
+			p = &profiles[i]
+			break
+		}
+	}
+	if p == nil {
+		if _, err := os.Stat(nameOrPath); err != nil {
+			return nil, fmt.Errorf("unknown profile %s, it is neither a built-in profile nor a profile file",
+				nameOrPath)
+		}
+		var err error
+		if p, err = workload.LoadProfile(nameOrPath); err != nil {
+			return nil, err
+		}
+	}
+
+	txnNames := make([]string, 0, len(w.txns()))
+	for _, t := range w.txns() {
+		txnNames = append(txnNames, t.name)
+	}
+	if err := p.Validate(txnNames); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,101 @@
+package bookshop
+
+import "github.com/Mini256/tidb-dataset/pkg/workload"
+
+// Storage engines which can be chosen by the read_from_storage hint.
+const (
+	engineTiKV    = "tikv"
+	engineTiFlash = "tiflash"
+)
+
+// queries is the built-in analytical queries of the bookshop dataset, the
+// tables in the subqueries are referred with the query block names.
+var queries = []workload.Query{
+	{
+		Name:        "book-sales-by-type",
+		Description: "Orders, sold books and revenue of each book type",
+		Tables:      []string{"o", "b"},
+		SQL: `SELECT b.type, COUNT(*) AS orders, SUM(o.quality) AS books, SUM(o.quality * b.price) AS revenue
+			FROM orders o JOIN books b ON o.book_id = b.id
+			GROUP BY b.type ORDER BY revenue DESC`,
+	},
+	{
+		Name:        "top-selling-books-per-type",
+		Description: "Top 3 selling books of each book type",
+		Tables:      []string{"o@sel_2", "b@sel_2"},
+		SQL: `SELECT type, id, title, books FROM (
+				SELECT b.type, b.id, b.title, SUM(o.quality) AS books,
+					ROW_NUMBER() OVER (PARTITION BY b.type ORDER BY SUM(o.quality) DESC) AS rank_in_type
+				FROM orders o JOIN books b ON o.book_id = b.id
+				GROUP BY b.type, b.id, b.title
+			) ranked
+			WHERE rank_in_type <= 3 ORDER BY type, books DESC`,
+	},
+	{
+		Name:        "monthly-orders",
+		Description: "Orders and sold books of each month",
+		Tables:      []string{"orders"},
+		SQL: `SELECT DATE_FORMAT(ordered_at, '%Y-%m') AS month, COUNT(*) AS orders, SUM(quality) AS books
+			FROM orders
+			GROUP BY month ORDER BY month`,
+	},
+	{
+		Name:        "top-author-revenue",
+		Description: "Top 10 authors by the revenue of their books",
+		Tables:      []string{"o", "ba", "a", "b"},
+		SQL: `SELECT a.id, a.name, SUM(o.quality * b.price) AS revenue
+			FROM orders o
+			JOIN books b ON o.book_id = b.id
+			JOIN book_authors ba ON o.book_id = ba.book_id
+			JOIN authors a ON ba.author_id = a.id
+			GROUP BY a.id, a.name ORDER BY revenue DESC LIMIT 10`,
+	},
+	{
+		Name:        "top-spending-users",
+		Description: "Top 10 users by the money spent on books",
+		Tables:      []string{"o", "u", "b"},
+		SQL: `SELECT u.id, u.nickname, COUNT(*) AS orders, SUM(o.quality * b.price) AS spent
+			FROM orders o
+			JOIN users u ON o.user_id = u.id
+			JOIN books b ON o.book_id = b.id
+			GROUP BY u.id, u.nickname ORDER BY spent DESC LIMIT 10`,
+	},
+	{
+		Name:        "user-cohorts",
+		Description: "Users and their orders grouped by the month of the first order",
+		Tables:      []string{"orders@sel_2"},
+		SQL: `SELECT first_month, COUNT(*) AS users, SUM(orders) AS orders FROM (
+				SELECT user_id, DATE_FORMAT(MIN(ordered_at), '%Y-%m') AS first_month, COUNT(*) AS orders
+				FROM orders
+				GROUP BY user_id
+			) cohorts
+			GROUP BY first_month ORDER BY first_month`,
+	},
+	{
+		Name:        "rating-histogram",
+		Description: "Number of ratings of each score",
+		Tables:      []string{"ratings"},
+		SQL: `SELECT score, COUNT(*) AS ratings
+			FROM ratings
+			GROUP BY score ORDER BY score`,
+	},
+	{
+		Name:        "top-rated-books",
+		Description: "Top 10 books by the average score with at least 10 ratings",
+		Tables:      []string{"r", "b"},
+		SQL: `SELECT b.id, b.title, AVG(r.score) AS average_score, COUNT(*) AS ratings
+			FROM ratings r JOIN books b ON r.book_id = b.id
+			GROUP BY b.id, b.title HAVING COUNT(*) >= 10
+			ORDER BY average_score DESC, ratings DESC LIMIT 10`,
+	},
+}
+
+// Queries returns the built-in queries of the bookshop dataset.
+func Queries() []workload.Query {
+	return queries
+}
+
+// Queries implements Workloader interface.
+func (w *Workloader) Queries() []workload.Query {
+	return Queries()
+}
@@ -0,0 +1,234 @@
+package bookshop
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ReadModeKind is the way the read transactions read the data.
+type ReadModeKind string
+
+const (
+	// ReadLeader reads from the leader replicas.
+	ReadLeader ReadModeKind = "leader"
+	// ReadFollower reads from the follower replicas by tidb_replica_read.
+	ReadFollower ReadModeKind = "follower"
+	// ReadStale reads the stale data by tidb_read_staleness.
+	ReadStale ReadModeKind = "stale"
+	// ReadAsOf reads the stale data in the transactions started by AS OF
+	// TIMESTAMP.
+	ReadAsOf ReadModeKind = "as-of"
+)
+
+// DefaultFreshnessInterval is the interval of probing the freshness of the
+// stale reads.
+const DefaultFreshnessInterval = time.Second
+
+// freshnessWindow is the time window of the recent orders probed.
+const freshnessWindow = time.Minute
+
+// ReadMode is the way the read transactions read the data, the staleness is
+// only used by the stale and as-of modes.
+type ReadMode struct {
+	Kind      ReadModeKind
+	Staleness time.Duration
+}
+
+// ParseReadMode parses the read mode, e.g. leader, follower, stale:5s or
+// as-of:5s.
+func ParseReadMode(s string) (ReadMode, error) {
+	parts := strings.SplitN(s, ":", 2)
+	m := ReadMode{Kind: ReadModeKind(parts[0])}
+	switch m.Kind {
+	case ReadLeader, ReadFollower:
+		if len(parts) > 1 {
+			return m, fmt.Errorf("read mode %s has no staleness", parts[0])
+		}
+	case ReadStale, ReadAsOf:
+		if len(parts) < 2 {
+			return m, fmt.Errorf("read mode %s needs the staleness, e.g. %s:5s", s, s)
+		}
+		d, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return m, fmt.Errorf("invalid staleness of read mode %s: %v", s, err)
+		}
+		if d < time.Second || d%time.Second != 0 {
+			return m, fmt.Errorf("the staleness of read mode %s must be whole seconds", s)
+		}
+		m.Staleness = d
+	default:
+		return m, fmt.Errorf("unknown read mode %q, available: leader, follower, stale:<duration>, as-of:<duration>", s)
+	}
+	return m, nil
+}
+
+func (m ReadMode) String() string {
+	if m.Staleness > 0 {
+		return fmt.Sprintf("%s:%s", m.Kind, m.Staleness)
+	}
+	return string(m.Kind)
+}
+
+// sessionVars returns the statements setting the session variables of the
+// mode, all the variables are set since the connections are reused by the
+// later runs.
+func (m ReadMode) sessionVars() []string {
+	replicaRead, staleness := "leader", 0
+	switch m.Kind {
+	case ReadFollower:
+		replicaRead = "follower"
+	case ReadStale:
+		staleness = -int(m.Staleness / time.Second)
+	}
+	return []string{
+		fmt.Sprintf("SET SESSION tidb_replica_read = '%s'", replicaRead),
+		fmt.Sprintf("SET SESSION tidb_read_staleness = %d", staleness),
+	}
+}
+
+// asOfTimestamp returns the AS OF TIMESTAMP clause of the as-of mode.
+func (m ReadMode) asOfTimestamp() string {
+	return fmt.Sprintf("AS OF TIMESTAMP NOW() - INTERVAL %d SECOND", int(m.Staleness/time.Second))
+}
+
+// SetReadMode sets the read mode of the sessions created by InitThread
+// afterwards.
+func (w *Workloader) SetReadMode(m ReadMode) {
+	w.readMode = m
+}
+
+func (w *Workloader) applyReadMode(ctx context.Context, conn *sql.Conn) error {
+	if w.readMode.Kind == "" {
+		return nil
+	}
+	for _, stmt := range w.readMode.sessionVars() {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inReadTxn executes the read function, which is wrapped in a read-only
+// transaction of the stale snapshot in the as-of mode.
+func (w *Workloader) inReadTxn(ctx context.Context, s *bookState, fn func() error) error {
+	if w.readMode.Kind != ReadAsOf {
+		return fn()
+	}
+
+	if _, err := s.Conn.ExecContext(ctx, "START TRANSACTION READ ONLY "+w.readMode.asOfTimestamp()); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		_, _ = s.Conn.ExecContext(ctx, "ROLLBACK")
+		return err
+	}
+	_, err := s.Conn.ExecContext(ctx, "COMMIT")
+	return err
+}
+
+// Freshness is the result of probing how many recent orders are missed by the
+// reads of the read mode.
+type Freshness struct {
+	Probes   int
+	Failures int
+	// Stale is the number of the probes missing any recent order.
+	Stale     int
+	Missed    int64
+	MaxMissed int64
+}
+
+// AvgMissed returns the average number of the recent orders missed by a read.
+func (f *Freshness) AvgMissed() float64 {
+	if f.Probes == 0 {
+		return 0
+	}
+	return float64(f.Missed) / float64(f.Probes)
+}
+
+// ProbeFreshness counts the orders of the recent minute by the read mode and
+// by the latest snapshot every interval until the context is done, the
+// difference is the number of the recent orders missed by the read mode.
+func (w *Workloader) ProbeFreshness(ctx context.Context, interval time.Duration) (*Freshness, error) {
+	conn, err := w.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := w.applyReadMode(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	f := &Freshness{}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		missed, err := w.missedOrders(ctx, conn)
+		switch {
+		case ctx.Err() != nil:
+			return f, nil
+		case err != nil:
+			f.Failures++
+			w.log.WithError(err).Debug("failed to probe the freshness")
+		default:
+			f.Probes++
+			f.Missed += missed
+			if missed > 0 {
+				f.Stale++
+			}
+			if missed > f.MaxMissed {
+				f.MaxMissed = missed
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return f, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// missedOrders returns the number of the orders of the recent window which are
+// missed by the read mode.
+func (w *Workloader) missedOrders(ctx context.Context, conn *sql.Conn) (int64, error) {
+	// Both counts use the same window start given by the server clock.
+	var since string
+	query := fmt.Sprintf("SELECT NOW() - INTERVAL %d SECOND", int(freshnessWindow/time.Second))
+	if err := conn.QueryRowContext(ctx, query).Scan(&since); err != nil {
+		return 0, err
+	}
+
+	var read int64
+	query = fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE ordered_at >= ?", tableOrders)
+	if w.readMode.Kind == ReadAsOf {
+		query = fmt.Sprintf("SELECT COUNT(*) FROM %s %s WHERE ordered_at >= ?",
+			tableOrders, w.readMode.asOfTimestamp())
+	}
+	if err := conn.QueryRowContext(ctx, query, since).Scan(&read); err != nil {
+		return 0, err
+	}
+
+	// The statements in the explicit transactions always read the latest
+	// snapshot, even if tidb_read_staleness is set.
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var latest int64
+	query = fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE ordered_at >= ?", tableOrders)
+	if err := tx.QueryRowContext(ctx, query, since).Scan(&latest); err != nil {
+		return 0, err
+	}
+
+	if latest < read {
+		return 0, nil
+	}
+	return latest - read, nil
+}
@@ -0,0 +1,48 @@
+package bookshop
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseReadMode(t *testing.T) {
+	tests := []struct {
+		value string
+		want  ReadMode
+		err   bool
+	}{
+		{value: "leader", want: ReadMode{Kind: ReadLeader}},
+		{value: "follower", want: ReadMode{Kind: ReadFollower}},
+		{value: "stale:5s", want: ReadMode{Kind: ReadStale, Staleness: 5 * time.Second}},
+		{value: "as-of:1m", want: ReadMode{Kind: ReadAsOf, Staleness: time.Minute}},
+		{value: "leader:5s", err: true},
+		{value: "stale", err: true},
+		{value: "as-of:", err: true},
+		{value: "stale:five", err: true},
+		{value: "stale:500ms", err: true},
+		{value: "stale:1500ms", err: true},
+		{value: "stale:-5s", err: true},
+		{value: "learner", err: true},
+		{value: "", err: true},
+	}
+
+	for _, tt := range tests {
+		m, err := ParseReadMode(tt.value)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseReadMode(%q) = %v, want an error", tt.value, m)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseReadMode(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if m != tt.want {
+			t.Errorf("ParseReadMode(%q) = %v, want %v", tt.value, m, tt.want)
+		}
+		if m.String() != tt.want.String() {
+			t.Errorf("ParseReadMode(%q).String() = %s, want %s", tt.value, m, tt.want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package bookshop
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Mini256/tidb-dataset/pkg/db"
+)
+
+// ColumnType is the SQL type of a column of the generated rows, the values
+// of the columns are int64 for bigint, int for the other integers, float64
+// for decimal, string for varchar and enum, and time.Time for datetime.
+type ColumnType string
+
+// Types of the columns of the generated rows.
+const (
+	TypeBigInt   ColumnType = "bigint"
+	TypeInt      ColumnType = "int"
+	TypeSmallInt ColumnType = "smallint"
+	TypeTinyInt  ColumnType = "tinyint"
+	TypeDecimal  ColumnType = "decimal"
+	TypeVarchar  ColumnType = "varchar"
+	TypeEnum     ColumnType = "enum"
+	TypeDateTime ColumnType = "datetime"
+)
+
+// Column is a column of the generated rows of a table.
+type Column struct {
+	Name string
+	Type ColumnType
+	// Precision and Scale are the precision and the scale of the decimals.
+	Precision int
+	Scale     int
+	// Nullable tells whether the values may be nil.
+	Nullable bool
+}
+
+// tableColumns are the columns of the generated rows of the tables, in the
+// order of the values of the rows.
+var tableColumns = map[string][]Column{
+	tableUsers: {
+		{Name: "id", Type: TypeBigInt},
+		{Name: "nickname", Type: TypeVarchar},
+		{Name: "balance", Type: TypeDecimal, Precision: 15, Scale: 2},
+	},
+	tableBooks: {
+		{Name: "id", Type: TypeBigInt},
+		{Name: "title", Type: TypeVarchar},
+		{Name: "type", Type: TypeEnum},
+		{Name: "published_at", Type: TypeDateTime},
+		{Name: "stock", Type: TypeInt},
+		{Name: "price", Type: TypeDecimal, Precision: 15, Scale: 2},
+	},
+	tableAuthors: {
+		{Name: "id", Type: TypeBigInt},
+		{Name: "name", Type: TypeVarchar},
+		{Name: "gender", Type: TypeTinyInt},
+		{Name: "birth_year", Type: TypeSmallInt},
+		{Name: "death_year", Type: TypeSmallInt, Nullable: true},
+	},
+	tableBookAuthors: {
+		{Name: "book_id", Type: TypeBigInt},
+		{Name: "author_id", Type: TypeBigInt},
+	},
+	tableOrders: {
+		{Name: "id", Type: TypeBigInt},
+		{Name: "book_id", Type: TypeBigInt},
+		{Name: "user_id", Type: TypeBigInt},
+		{Name: "quality", Type: TypeTinyInt},
+		{Name: "ordered_at", Type: TypeDateTime},
+	},
+	tableRatings: {
+		{Name: "book_id", Type: TypeBigInt},
+		{Name: "user_id", Type: TypeBigInt},
+		{Name: "score", Type: TypeTinyInt},
+		{Name: "rated_at", Type: TypeDateTime},
+	},
+}
+
+// RowWriter writes the generated rows of a table.
+type RowWriter interface {
+	WriteRow(ctx context.Context, row []interface{}) error
+	// Close writes the pending rows.
+	Close(ctx context.Context) error
+}
+
+// RowSink receives the generated rows of the tables instead of the database,
+// e.g. writes them into the files.
+type RowSink interface {
+	OpenTable(table string, columns []Column) (RowWriter, error)
+}
+
+// hasServerID tells whether the id column of the table is assigned by the
+// server, so it is left out of the rows.
+func (w *Workloader) hasServerID(tableName string) bool {
+	columns := tableColumns[tableName]
+	return w.cfg.PKStrategy.ServerAssignedID() && len(columns) > 0 && columns[0].Name == "id"
+}
+
+// columns returns the columns of the generated rows of the table.
+func (w *Workloader) columns(tableName string) []Column {
+	if w.hasServerID(tableName) {
+		return tableColumns[tableName][1:]
+	}
+	return tableColumns[tableName]
+}
+
+// newRowWriter returns the writer of the rows of the table, which writes them
+// into the sink, the script or the database. The rows start with the id if
+// the table has the id column, which is dropped if it is assigned by the
+// server.
+func (w *Workloader) newRowWriter(tableName string) (RowWriter, error) {
+	rw, err := w.tableRowWriter(tableName)
+	if err != nil {
+		return nil, err
+	}
+	if w.hasServerID(tableName) {
+		return &serverIDRowWriter{RowWriter: rw}, nil
+	}
+	return rw, nil
+}
+
+func (w *Workloader) tableRowWriter(tableName string) (RowWriter, error) {
+	columns := w.columns(tableName)
+	if w.sink != nil {
+		return w.sink.OpenTable(tableName, columns)
+	}
+
+	names := make([]string, 0, len(columns))
+	for _, c := range columns {
+		names = append(names, c.Name)
+	}
+	dml := fmt.Sprintf("INSERT INTO %s (%s) VALUES", tableName, strings.Join(names, ", "))
+
+	var writer db.BatchWriter = w.script
+	if w.script == nil {
+		writer = db.NewExecBatchWriter(w.db, 3, 10)
+	}
+	return &sqlRowWriter{loader: db.NewBatchLoader(writer, tableName, dml, w.cfg.BatchSize)}, nil
+}
+
+// serverIDRowWriter drops the id at the head of the rows.
+type serverIDRowWriter struct {
+	RowWriter
+}
+
+func (s *serverIDRowWriter) WriteRow(ctx context.Context, row []interface{}) error {
+	return s.RowWriter.WriteRow(ctx, row[1:])
+}
+
+// sqlRowWriter writes the rows as the values of the INSERT statements.
+type sqlRowWriter struct {
+	loader *db.SQLBatchLoader
+}
+
+func (s *sqlRowWriter) WriteRow(ctx context.Context, row []interface{}) error {
+	values := make([]string, len(row))
+	for i, v := range row {
+		values[i] = sqlValue(v)
+	}
+	return s.loader.InsertValue(ctx, []string{"(" + strings.Join(values, ", ") + ")"})
+}
+
+func (s *sqlRowWriter) Close(ctx context.Context) error {
+	return s.loader.Flush(ctx)
+}
+
+var sqlEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// sqlValue returns the SQL literal of the value.
+func sqlValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "'" + sqlEscaper.Replace(v) + "'"
+	case float64:
+		return fmt.Sprintf("%f", v)
+	case time.Time:
+		return "'" + v.Format(MySQLDateTimeValue) + "'"
+	default:
+		return fmt.Sprint(v)
+	}
+}
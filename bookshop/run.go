@@ -0,0 +1,375 @@
+package bookshop
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/Mini256/tidb-dataset/pkg/measurement"
+	"github.com/Mini256/tidb-dataset/pkg/workload"
+	rand "github.com/brianvoe/gofakeit/v6"
+	"github.com/go-sql-driver/mysql"
+)
+
+// Transaction types of the run workload.
+const (
+	txnNewOrder    = "new-order"
+	txnRateBook    = "rate-book"
+	txnViewBook    = "view-book"
+	txnUserOrders  = "user-orders"
+	txnSalesReport = "sales-report"
+)
+
+// readTxns lists the read transaction types, which follow the read mode.
+var readTxns = []string{txnViewBook, txnUserOrders, txnSalesReport}
+
+// ReadTxns returns the read transaction types of the run workload.
+func ReadTxns() []string {
+	return readTxns
+}
+
+// txn is a transaction type of the run workload, the weight is given by the
+// profile of the run.
+type txn struct {
+	name   string
+	weight int
+	run    func(ctx context.Context, s *bookState) error
+}
+
+// runState is the state shared by the threads of the run workload.
+type runState struct {
+	profile *workload.Profile
+	userIDs []int64
+	bookIDs []int64
+	// serverAssignedOrderID tells whether the order ids are assigned by the
+	// server, which depends on the primary key strategy of the prepare.
+	serverAssignedOrderID bool
+	// hotBookIDs are the bestsellers bought by the hot-book scenario.
+	hotBookIDs []int64
+}
+
+// autoIDColumn matches the definition of the id column assigned by the server
+// in the output of SHOW CREATE TABLE.
+var autoIDColumn = regexp.MustCompile("(?m)^\\s*`id` .*(AUTO_INCREMENT|AUTO_RANDOM)")
+
+// txns returns all the transaction types of the run workload.
+func (w *Workloader) txns() []txn {
+	return []txn{
+		{name: txnNewOrder, run: w.newOrder},
+		{name: txnRateBook, run: w.rateBook},
+		{name: txnViewBook, run: w.viewBook},
+		{name: txnUserOrders, run: w.userOrders},
+		{name: txnSalesReport, run: w.salesReport},
+	}
+}
+
+// pickTxn picks a transaction type randomly by the weights.
+func (w *Workloader) pickTxn() txn {
+	total := 0
+	for _, t := range w.runTxns {
+		total += t.weight
+	}
+
+	n := rand.IntRange(0, total-1)
+	for _, t := range w.runTxns {
+		if n < t.weight {
+			return t
+		}
+		n -= t.weight
+	}
+	return w.runTxns[len(w.runTxns)-1]
+}
+
+// InitRun implements Workloader interface, it validates the profile and loads
+// the ids of the prepared data for the run workload.
+func (w *Workloader) InitRun(ctx context.Context) error {
+	state := &runState{}
+
+	var err error
+	if state.profile, err = w.loadProfile(w.cfg.Profile); err != nil {
+		return err
+	}
+	w.runTxns = w.runTxns[:0]
+	if w.cfg.Scenario != "" {
+		w.runTxns = append(w.runTxns, w.scenarioTxn())
+		w.log.Infof("Running scenario %s with profile %s.", w.cfg.Scenario, state.profile.Name)
+	} else {
+		for _, t := range w.txns() {
+			if t.weight = state.profile.Weights[t.name]; t.weight > 0 {
+				w.runTxns = append(w.runTxns, t)
+			}
+		}
+		w.log.Infof("Running with profile %s.", state.profile.Name)
+	}
+
+	if state.userIDs, err = w.queryIDs(ctx, tableUsers); err != nil {
+		return err
+	}
+	if state.bookIDs, err = w.queryIDs(ctx, tableBooks); err != nil {
+		return err
+	}
+	if len(state.userIDs) == 0 || len(state.bookIDs) == 0 {
+		return fmt.Errorf("no users or books found, please prepare the data first")
+	}
+
+	if state.serverAssignedOrderID, err = w.serverAssignedID(ctx, tableOrders); err != nil {
+		return err
+	}
+
+	if w.cfg.Scenario == ScenarioHotBook {
+		if state.hotBookIDs, err = w.queryHotBookIDs(ctx, state.bookIDs); err != nil {
+			return err
+		}
+		w.log.Infof("Buying the hot books %v in the %s mode.", state.hotBookIDs, w.txnModeName())
+	}
+	w.contention.reset()
+
+	w.run = state
+	return nil
+}
+
+// serverAssignedID tells whether the ids of the table are assigned by the
+// server, which depends on the primary key strategy of the prepare.
+func (w *Workloader) serverAssignedID(ctx context.Context, tableName string) (bool, error) {
+	var name, createTable string
+	query := fmt.Sprintf("SHOW CREATE TABLE %s", tableName)
+	if err := w.db.QueryRowContext(ctx, query).Scan(&name, &createTable); err != nil {
+		return false, err
+	}
+	return autoIDColumn.MatchString(createTable), nil
+}
+
+func (w *Workloader) queryIDs(ctx context.Context, tableName string) ([]int64, error) {
+	rows, err := w.db.QueryContext(ctx, fmt.Sprintf("SELECT id FROM %s", tableName))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Run implements Workloader interface, it executes a transaction picked by
+// the weights and measures it.
+func (w *Workloader) Run(ctx context.Context) error {
+	s, err := getBookState(ctx)
+	if err != nil {
+		return err
+	}
+
+	t := w.pickTxn()
+	start := time.Now()
+	err = t.run(ctx, s)
+	if ctx.Err() != nil {
+		// The run is canceled, the transaction is not measured.
+		return ctx.Err()
+	}
+	w.measurement.Measure(t.name, time.Since(start), err)
+
+	if think := w.run.profile.ThinkTime; think > 0 {
+		select {
+		case <-ctx.Done():
+		case <-time.After(think):
+		}
+	}
+
+	if refreshErr := w.refreshBadConn(ctx, s, err); refreshErr != nil {
+		return refreshErr
+	}
+	return err
+}
+
+// refreshBadConn replaces the connection of the thread if the error shows it
+// is broken, the session of the new connection is set up again.
+func (w *Workloader) refreshBadConn(ctx context.Context, s *bookState, err error) error {
+	if !errors.Is(err, driver.ErrBadConn) && !errors.Is(err, mysql.ErrInvalidConn) {
+		return nil
+	}
+	if s.Conn != nil {
+		_ = s.Conn.Close()
+	}
+	if err := s.RefreshConn(ctx); err != nil {
+		return err
+	}
+	w.initSession(ctx, s.Conn)
+	return nil
+}
+
+// Measurement implements Workloader interface.
+func (w *Workloader) Measurement() *measurement.Measurement {
+	return w.measurement
+}
+
+// randomUserID picks a user, which follows the access skew of the profile.
+func (w *Workloader) randomUserID(s *bookState) int64 {
+	if s.userZipf != nil {
+		return w.run.userIDs[s.userZipf.Uint64()]
+	}
+	return w.run.userIDs[rand.IntRange(0, len(w.run.userIDs)-1)]
+}
+
+// randomBookID picks a book, which follows the access skew of the profile.
+func (w *Workloader) randomBookID(s *bookState) int64 {
+	if s.bookZipf != nil {
+		return w.run.bookIDs[s.bookZipf.Uint64()]
+	}
+	return w.run.bookIDs[rand.IntRange(0, len(w.run.bookIDs)-1)]
+}
+
+// inTxn executes the function in a transaction, which is rolled back if the
+// function fails.
+func inTxn(ctx context.Context, s *bookState, fn func(tx *sql.Tx) error) error {
+	tx, err := s.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// newOrder buys some copies of a book, the stock of the book and the balance
+// of the user are decreased, the book is restocked if it is out of stock.
+func (w *Workloader) newOrder(ctx context.Context, s *bookState) error {
+	userID, bookID := w.randomUserID(s), w.randomBookID(s)
+	quality := rand.IntRange(1, 10)
+
+	return inTxn(ctx, s, func(tx *sql.Tx) error {
+		var (
+			stock int
+			price float64
+		)
+		query := "SELECT stock, price FROM books WHERE id = ? FOR UPDATE"
+		if err := tx.QueryRowContext(ctx, query, bookID).Scan(&stock, &price); err != nil {
+			return err
+		}
+		if stock < quality {
+			// Restock the book before placing the order, so that every
+			// measured new-order inserts an order.
+			if _, err := tx.ExecContext(ctx,
+				"UPDATE books SET stock = stock + 1000 WHERE id = ?", bookID); err != nil {
+				return err
+			}
+		}
+
+		if err := w.insertOrder(ctx, tx, bookID, userID, quality); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE books SET stock = stock - ? WHERE id = ?", quality, bookID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx,
+			"UPDATE users SET balance = balance - ? WHERE id = ?", price*float64(quality), userID)
+		return err
+	})
+}
+
+// insertOrder inserts an order in the transaction.
+func (w *Workloader) insertOrder(ctx context.Context, tx *sql.Tx, bookID, userID int64, quality int) error {
+	var err error
+	if w.run.serverAssignedOrderID {
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO orders (book_id, user_id, quality, ordered_at) VALUES (?, ?, ?, NOW())",
+			bookID, userID, quality)
+	} else {
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO orders (id, book_id, user_id, quality, ordered_at) VALUES (?, ?, ?, ?, NOW())",
+			rand.UintRange(minRandomID, maxRandomID), bookID, userID, quality)
+	}
+	return err
+}
+
+// rateBook rates a book, or updates the rating if the user has rated it.
+func (w *Workloader) rateBook(ctx context.Context, s *bookState) error {
+	_, err := s.Conn.ExecContext(ctx, `
+		INSERT INTO ratings (book_id, user_id, score, rated_at) VALUES (?, ?, ?, NOW())
+		ON DUPLICATE KEY UPDATE score = VALUES(score), rated_at = VALUES(rated_at)
+	`, w.randomBookID(s), w.randomUserID(s), rand.IntRange(0, 5))
+	return err
+}
+
+// viewBook reads the details of a book with its authors and average score.
+func (w *Workloader) viewBook(ctx context.Context, s *bookState) error {
+	bookID := w.randomBookID(s)
+
+	return w.inReadTxn(ctx, s, func() error {
+		var (
+			title, bookType string
+			price           float64
+		)
+		query := "SELECT title, type, price FROM books WHERE id = ?"
+		if err := s.Conn.QueryRowContext(ctx, query, bookID).Scan(&title, &bookType, &price); err != nil {
+			return err
+		}
+
+		if _, err := drainQuery(ctx, s, `
+			SELECT a.id, a.name FROM book_authors ba JOIN authors a ON ba.author_id = a.id
+			WHERE ba.book_id = ?
+		`, bookID); err != nil {
+			return err
+		}
+
+		var score sql.NullFloat64
+		query = "SELECT AVG(score) FROM ratings WHERE book_id = ?"
+		return s.Conn.QueryRowContext(ctx, query, bookID).Scan(&score)
+	})
+}
+
+// userOrders reads the recent orders of a user.
+func (w *Workloader) userOrders(ctx context.Context, s *bookState) error {
+	userID := w.randomUserID(s)
+
+	return w.inReadTxn(ctx, s, func() error {
+		_, err := drainQuery(ctx, s, `
+			SELECT o.id, o.quality, o.ordered_at, b.title, b.price
+			FROM orders o JOIN books b ON o.book_id = b.id
+			WHERE o.user_id = ? ORDER BY o.ordered_at DESC LIMIT 10
+		`, userID)
+		return err
+	})
+}
+
+// salesReport reads the sales of each book type in the recent month.
+func (w *Workloader) salesReport(ctx context.Context, s *bookState) error {
+	return w.inReadTxn(ctx, s, func() error {
+		_, err := drainQuery(ctx, s, `
+			SELECT b.type, COUNT(*) AS orders, SUM(o.quality * b.price) AS revenue
+			FROM orders o JOIN books b ON o.book_id = b.id
+			WHERE o.ordered_at >= NOW() - INTERVAL 1 MONTH
+			GROUP BY b.type
+		`)
+		return err
+	})
+}
+
+// drainQuery executes the query and reads all the result rows, returning the
+// number of rows.
+func drainQuery(ctx context.Context, s *bookState, query string, args ...interface{}) (int, error) {
+	rows, err := s.Conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		count++
+	}
+	return count, rows.Err()
+}
@@ -0,0 +1,244 @@
+package bookshop
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	rand "github.com/brianvoe/gofakeit/v6"
+	"github.com/go-sql-driver/mysql"
+)
+
+// Scenarios of the run workload.
+const (
+	// ScenarioHotBook lets all the threads buy the same few bestsellers, which
+	// demonstrates the write conflicts of the transaction modes.
+	ScenarioHotBook = "hot-book"
+	// ScenarioBank transfers the balance between the users, while a verifier
+	// checks that the total balance never changes.
+	ScenarioBank = "bank"
+)
+
+// Scenarios lists all the supported scenarios of the run workload.
+var Scenarios = []string{ScenarioHotBook, ScenarioBank}
+
+// DefaultHotBooks is the default number of the bestsellers bought by the
+// hot-book scenario.
+const DefaultHotBooks = 3
+
+// Transaction modes of TiDB.
+const (
+	TxnModeOptimistic  = "optimistic"
+	TxnModePessimistic = "pessimistic"
+)
+
+// TxnModes lists the transaction modes compared by the hot-book scenario.
+var TxnModes = []string{TxnModeOptimistic, TxnModePessimistic}
+
+const txnHotBook = "hot-book"
+
+// maxConflictRetries is the number of times a conflicted transaction of the
+// scenarios is retried by the client.
+const maxConflictRetries = 5
+
+// MySQL error codes of the conflicted transactions.
+const (
+	errCodeLockWaitTimeout   = 1205
+	errCodeDeadlock          = 1213
+	errCodeForUpdateConflict = 8002
+	errCodeTxnRetryable      = 8022
+	errCodeWriteConflict     = 9007
+)
+
+func validateScenario(scenario string) error {
+	if scenario == "" {
+		return nil
+	}
+	for _, s := range Scenarios {
+		if scenario == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown scenario %q, available: %v", scenario, Scenarios)
+}
+
+// contention counts the conflicts and the lock waits of the run.
+type contention struct {
+	conflicts        int64
+	retries          int64
+	lockWaitTimeouts int64
+	lockWaitNanos    int64
+	lockWaits        int64
+}
+
+func (c *contention) reset() {
+	atomic.StoreInt64(&c.conflicts, 0)
+	atomic.StoreInt64(&c.retries, 0)
+	atomic.StoreInt64(&c.lockWaitTimeouts, 0)
+	atomic.StoreInt64(&c.lockWaitNanos, 0)
+	atomic.StoreInt64(&c.lockWaits, 0)
+}
+
+// ContentionStats is the summary of the conflicts and the lock waits of a run.
+type ContentionStats struct {
+	// Conflicts is the number of the write conflict errors (9007 and 8002).
+	Conflicts int64
+	// Retries is the number of the conflicted transactions retried.
+	Retries int64
+	// LockWaitTimeouts is the number of the lock wait timeout errors (1205).
+	LockWaitTimeouts int64
+	// LockWait is the total time spent on locking the hot books, and
+	// LockWaits is the number of the locks.
+	LockWait  time.Duration
+	LockWaits int64
+}
+
+// AvgLockWait returns the average time spent on locking a hot book.
+func (s ContentionStats) AvgLockWait() time.Duration {
+	if s.LockWaits == 0 {
+		return 0
+	}
+	return s.LockWait / time.Duration(s.LockWaits)
+}
+
+// EndWarmup resets the conflicts and the lock waits at the end of the warmup,
+// so that they are counted in the same period as the measurement.
+func (w *Workloader) EndWarmup() {
+	w.contention.reset()
+}
+
+// Contention returns the conflicts and the lock waits since InitRun or the
+// end of the warmup.
+func (w *Workloader) Contention() ContentionStats {
+	return ContentionStats{
+		Conflicts:        atomic.LoadInt64(&w.contention.conflicts),
+		Retries:          atomic.LoadInt64(&w.contention.retries),
+		LockWaitTimeouts: atomic.LoadInt64(&w.contention.lockWaitTimeouts),
+		LockWait:         time.Duration(atomic.LoadInt64(&w.contention.lockWaitNanos)),
+		LockWaits:        atomic.LoadInt64(&w.contention.lockWaits),
+	}
+}
+
+// SetTxnMode sets the tidb_txn_mode of the sessions created by InitThread
+// afterwards, empty means the default mode of the server.
+func (w *Workloader) SetTxnMode(mode string) {
+	w.txnMode = mode
+}
+
+func (w *Workloader) txnModeName() string {
+	if w.txnMode == "" {
+		return "default"
+	}
+	return w.txnMode
+}
+
+// scenarioTxn returns the only transaction type of the scenario.
+func (w *Workloader) scenarioTxn() txn {
+	if w.cfg.Scenario == ScenarioBank {
+		return txn{name: txnTransfer, weight: 1, run: w.transfer}
+	}
+	return txn{name: txnHotBook, weight: 1, run: w.hotBookOrder}
+}
+
+// queryHotBookIDs returns the best selling books, or the first books if there
+// is no order yet.
+func (w *Workloader) queryHotBookIDs(ctx context.Context, bookIDs []int64) ([]int64, error) {
+	rows, err := w.db.QueryContext(ctx, `
+		SELECT book_id FROM orders GROUP BY book_id ORDER BY SUM(quality) DESC LIMIT ?
+	`, w.cfg.HotBooks)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		n := w.cfg.HotBooks
+		if n > len(bookIDs) {
+			n = len(bookIDs)
+		}
+		ids = append(ids, bookIDs[:n]...)
+	}
+	return ids, nil
+}
+
+// hotBookOrder buys a copy of a hot book.
+func (w *Workloader) hotBookOrder(ctx context.Context, s *bookState) error {
+	userID := w.randomUserID(s)
+	bookID := w.run.hotBookIDs[rand.IntRange(0, len(w.run.hotBookIDs)-1)]
+
+	return w.retryConflicts(ctx, s, func(tx *sql.Tx) error {
+		return w.buyHotBook(ctx, tx, bookID, userID)
+	})
+}
+
+// retryConflicts executes the function in a transaction, the conflicted
+// transaction is retried up to maxConflictRetries times.
+func (w *Workloader) retryConflicts(ctx context.Context, s *bookState, fn func(tx *sql.Tx) error) error {
+	var err error
+	for i := 0; i <= maxConflictRetries; i++ {
+		if i > 0 {
+			atomic.AddInt64(&w.contention.retries, 1)
+		}
+		if err = inTxn(ctx, s, fn); !w.countConflict(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func (w *Workloader) buyHotBook(ctx context.Context, tx *sql.Tx, bookID, userID int64) error {
+	var stock int
+	start := time.Now()
+	query := "SELECT stock FROM books WHERE id = ? FOR UPDATE"
+	if err := tx.QueryRowContext(ctx, query, bookID).Scan(&stock); err != nil {
+		return err
+	}
+	atomic.AddInt64(&w.contention.lockWaitNanos, int64(time.Since(start)))
+	atomic.AddInt64(&w.contention.lockWaits, 1)
+
+	if stock < 1 {
+		if _, err := tx.ExecContext(ctx, "UPDATE books SET stock = stock + 1000 WHERE id = ?", bookID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE books SET stock = stock - 1 WHERE id = ?", bookID); err != nil {
+		return err
+	}
+	return w.insertOrder(ctx, tx, bookID, userID, 1)
+}
+
+// countConflict counts the error if the transaction is conflicted, and tells
+// whether the transaction can be retried.
+func (w *Workloader) countConflict(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+
+	switch mysqlErr.Number {
+	case errCodeWriteConflict, errCodeForUpdateConflict:
+		atomic.AddInt64(&w.contention.conflicts, 1)
+		return true
+	case errCodeLockWaitTimeout:
+		atomic.AddInt64(&w.contention.lockWaitTimeouts, 1)
+		return true
+	case errCodeDeadlock, errCodeTxnRetryable:
+		return true
+	}
+	return false
+}
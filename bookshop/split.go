@@ -0,0 +1,172 @@
+package bookshop
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	// DefaultSplitRowsPerRegion is the planned number of rows in each region
+	// when pre-splitting the regions.
+	DefaultSplitRowsPerRegion = 10000
+
+	// maxSplitRegions is the maximum number of regions split by one statement.
+	maxSplitRegions = 1000
+)
+
+// regionSplit is a SPLIT TABLE statement splitting the rows or the index of a
+// table evenly between the lower and upper values.
+type regionSplit struct {
+	table   string
+	index   string
+	lower   string
+	upper   string
+	regions int
+}
+
+// target returns the table or the index to split.
+func (r regionSplit) target() string {
+	if r.index != "" {
+		return fmt.Sprintf("%s INDEX %s", r.table, r.index)
+	}
+	return r.table
+}
+
+func (r regionSplit) String() string {
+	return fmt.Sprintf("SPLIT TABLE %s BETWEEN (%s) AND (%s) REGIONS %d;", r.target(), r.lower, r.upper, r.regions)
+}
+
+// regionCount returns the number of regions planned for the rows.
+func (w *ddlManager) regionCount(rows int) int {
+	rowsPerRegion := w.cfg.SplitRowsPerRegion
+	if rowsPerRegion <= 0 {
+		rowsPerRegion = DefaultSplitRowsPerRegion
+	}
+	regions := (rows + rowsPerRegion - 1) / rowsPerRegion
+	if regions > maxSplitRegions {
+		regions = maxSplitRegions
+	}
+	return regions
+}
+
+// idRange returns the range of the ids of the table with the rows.
+func (w *ddlManager) idRange(rows int) (string, string) {
+	switch w.cfg.PKStrategy {
+	case PKAutoIncrement, PKShardRowIDBits:
+		return "1", fmt.Sprint(rows)
+	case PKAutoRandom:
+		// The shard bits of the AUTO_RANDOM ids take the highest bits.
+		return "0", fmt.Sprint(int64(math.MaxInt64))
+	default:
+		return fmt.Sprint(minRandomID), fmt.Sprint(int64(maxRandomID))
+	}
+}
+
+// rowKeyRange returns the range of the row keys of the table, which are the
+// ids for the clustered tables and the hidden row ids for the others.
+func (w *ddlManager) rowKeyRange(clustered bool, rows int) (string, string) {
+	switch {
+	case w.cfg.PKStrategy == PKShardRowIDBits:
+		// The shard bits of the hidden row ids take the highest bits.
+		return "0", fmt.Sprint(int64(math.MaxInt64))
+	case w.cfg.PKStrategy == PKAutoRandom || clustered:
+		return w.idRange(rows)
+	default:
+		return "1", fmt.Sprint(rows)
+	}
+}
+
+// regionSplits plans the region splits of the tables and indexes according
+// to the known id ranges and the planned row counts.
+func (w *ddlManager) regionSplits() []regionSplit {
+	var splits []regionSplit
+	add := func(table, index string, rows int, lower, upper string) {
+		if w.cfg.Partitions.get(table) != nil {
+			// The partitions of the table are in different regions already.
+			return
+		}
+		if regions := w.regionCount(rows); regions > 1 {
+			splits = append(splits, regionSplit{table, index, lower, upper, regions})
+		}
+	}
+
+	bookLower, bookUpper := w.idRange(w.cfg.BookCount)
+	userLower, userUpper := w.idRange(w.cfg.UserCount)
+
+	// Books.
+	lower, upper := w.rowKeyRange(true, w.cfg.BookCount)
+	add(tableBooks, "", w.cfg.BookCount, lower, upper)
+
+	// Users.
+	lower, upper = w.rowKeyRange(false, w.cfg.UserCount)
+	add(tableUsers, "", w.cfg.UserCount, lower, upper)
+	if w.cfg.PKStrategy != PKAutoRandom {
+		add(tableUsers, "`PRIMARY`", w.cfg.UserCount, userLower, userUpper)
+	}
+	add(tableUsers, "nickname", w.cfg.UserCount, "'A'", "'z'")
+
+	// Authors.
+	lower, upper = w.rowKeyRange(true, w.cfg.AuthorCount)
+	add(tableAuthors, "", w.cfg.AuthorCount, lower, upper)
+
+	// Book Authors, one author for each book.
+	add(tableBookAuthors, "", w.cfg.BookCount, bookLower, bookUpper)
+
+	// Orders.
+	lower, upper = w.rowKeyRange(true, w.cfg.OrderCount)
+	add(tableOrders, "", w.cfg.OrderCount, lower, upper)
+	if w.cfg.PKStrategy == PKShardRowIDBits {
+		lower, upper = w.idRange(w.cfg.OrderCount)
+		add(tableOrders, "`PRIMARY`", w.cfg.OrderCount, lower, upper)
+	}
+	add(tableOrders, "orders_book_id_idx", w.cfg.OrderCount, bookLower, bookUpper)
+
+	// Ratings.
+	add(tableRatings, "", w.cfg.RatingCount, bookLower, bookUpper)
+	add(tableRatings, "uniq_book_user_idx", w.cfg.RatingCount, bookLower, bookUpper)
+
+	return splits
+}
+
+// splitRegions pre-splits the regions of the tables before loading data, so
+// that the writes are not all on a single region of each table at first.
+func (w *ddlManager) splitRegions(ctx context.Context) error {
+	// Wait for the scatter of the new regions in the SPLIT statements.
+	if err := w.execTableDDL(ctx, "SET @@session.tidb_wait_split_region_finish = 1;"); err != nil {
+		return err
+	}
+	if w.script != nil {
+		for _, split := range w.regionSplits() {
+			if err := w.script.WriteStatement(split.String()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	s, err := getBookState(ctx)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	for _, split := range w.regionSplits() {
+		var (
+			query        = split.String()
+			totalRegions int
+			scatterRatio float64
+		)
+		w.log.Printf("Splitting %d regions of %s.\n", split.regions, split.target())
+		splitStart := time.Now()
+		if err := s.Conn.QueryRowContext(ctx, query).Scan(&totalRegions, &scatterRatio); err != nil {
+			return fmt.Errorf("failed to execute %s: %v", query, err)
+		}
+		w.log.Printf("Split %d regions of %s in %s, scatter finish ratio %.2f.\n",
+			totalRegions, split.target(), time.Since(splitStart).Round(time.Millisecond), scatterRatio)
+	}
+	w.log.Infof("Finished splitting regions in %s!", time.Since(start).Round(time.Millisecond))
+
+	return nil
+}
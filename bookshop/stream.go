@@ -0,0 +1,669 @@
+package bookshop
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	rand "github.com/brianvoe/gofakeit/v6"
+	"golang.org/x/time/rate"
+)
+
+// Operations of the change stream.
+const (
+	streamInsertOrder  = "insert-order"
+	streamInsertUser   = "insert-user"
+	streamUpdateStock  = "update-stock"
+	streamUpdateRating = "update-rating"
+	streamDeleteUser   = "delete-user"
+)
+
+// Kinds of the changes in the change log.
+const (
+	changeInsert = "insert"
+	changeUpdate = "update"
+	changeDelete = "delete"
+)
+
+// DefaultStreamThreads is the default number of the threads of each kind of
+// the mutations in the stream.
+const DefaultStreamThreads = 2
+
+// StreamConfig is the configuration of the change stream, the rates are the
+// mutations per second, 0 means no such mutation.
+type StreamConfig struct {
+	Inserts float64
+	Updates float64
+	Deletes float64
+	Threads int
+	// ChangeLog is the path of the JSON lines log of the changes, empty means
+	// no change log.
+	ChangeLog string
+}
+
+// Change is a row changed by the stream, which is written into the change log
+// as a JSON line. The after-image is absent for the deleted rows.
+type Change struct {
+	Time time.Time `json:"ts"`
+	// CommitTS is the commit ts of the transaction of the change, the changes
+	// are logged in the order of it.
+	CommitTS uint64                 `json:"commit_ts"`
+	Op       string                 `json:"op"`
+	Table    string                 `json:"table"`
+	PK       map[string]interface{} `json:"pk"`
+	After    map[string]interface{} `json:"after,omitempty"`
+}
+
+// streamOp is a mutation of the stream.
+type streamOp struct {
+	name string
+	run  func(ctx context.Context, s *bookState) error
+}
+
+// streamState is the state shared by the threads of the stream.
+type streamState struct {
+	users   *idPool
+	bookIDs []int64
+
+	serverAssignedUserID  bool
+	serverAssignedOrderID bool
+
+	// log is the change log, which is nil if the change log is disabled.
+	log *changeLog
+}
+
+// idPool is the ids of the live rows, which are added and removed by the
+// stream concurrently.
+type idPool struct {
+	mu    sync.Mutex
+	ids   []int64
+	index map[int64]int
+}
+
+func newIDPool(ids []int64) *idPool {
+	p := &idPool{ids: ids, index: make(map[int64]int, len(ids))}
+	for i, id := range ids {
+		p.index[id] = i
+	}
+	return p
+}
+
+func (p *idPool) add(id int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.index[id]; ok {
+		return
+	}
+	p.index[id] = len(p.ids)
+	p.ids = append(p.ids, id)
+}
+
+// random returns a random id, or false if the pool is empty.
+func (p *idPool) random() (int64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.ids) == 0 {
+		return 0, false
+	}
+	return p.ids[rand.IntRange(0, len(p.ids)-1)], true
+}
+
+// take removes a random id from the pool, or returns false if the pool is
+// empty.
+func (p *idPool) take() (int64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.ids) == 0 {
+		return 0, false
+	}
+	i := rand.IntRange(0, len(p.ids)-1)
+	id, last := p.ids[i], p.ids[len(p.ids)-1]
+	p.ids[i], p.index[last] = last, i
+	p.ids = p.ids[:len(p.ids)-1]
+	delete(p.index, id)
+	return id, true
+}
+
+// changeLog writes the changes as JSON lines in the order of the commit ts.
+// The changes of a committed transaction are kept until no transaction in
+// flight can commit before them, whose commit ts is greater than its start
+// ts.
+type changeLog struct {
+	mu  sync.Mutex
+	f   *os.File
+	buf *bufio.Writer
+	enc *json.Encoder
+
+	// inflight counts the start ts of the transactions not finished yet.
+	inflight map[uint64]int
+	// pending is the changes of the committed transactions sorted by the
+	// commit ts, which are not written yet.
+	pending []Change
+	// err is the first error of writing the log.
+	err error
+}
+
+func openChangeLog(path string) (*changeLog, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(f)
+	return &changeLog{f: f, buf: buf, enc: json.NewEncoder(buf), inflight: make(map[uint64]int)}, nil
+}
+
+// begin registers the transaction of the start ts in flight.
+func (l *changeLog) begin(startTS uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inflight[startTS]++
+}
+
+// finish removes the transaction of the start ts from the flight, and logs
+// the changes of the transaction if it is committed at the commit ts.
+func (l *changeLog) finish(startTS, commitTS uint64, changes []Change) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inflight[startTS]--; l.inflight[startTS] <= 0 {
+		delete(l.inflight, startTS)
+	}
+	now := time.Now()
+	for _, c := range changes {
+		c.Time, c.CommitTS = now, commitTS
+		l.pending = append(l.pending, c)
+	}
+	sort.SliceStable(l.pending, func(i, j int) bool {
+		return l.pending[i].CommitTS < l.pending[j].CommitTS
+	})
+	l.writePending(false)
+}
+
+// fail records the error of logging the changes.
+func (l *changeLog) fail(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.err == nil {
+		l.err = err
+	}
+}
+
+// writePending writes the pending changes committed before all the
+// transactions in flight, or all of them.
+func (l *changeLog) writePending(all bool) {
+	var watermark uint64 = math.MaxUint64
+	if !all {
+		for startTS := range l.inflight {
+			if startTS < watermark {
+				watermark = startTS
+			}
+		}
+	}
+
+	n := 0
+	for ; n < len(l.pending) && (all || l.pending[n].CommitTS < watermark); n++ {
+		if err := l.enc.Encode(l.pending[n]); err != nil && l.err == nil {
+			l.err = err
+		}
+	}
+	if n == 0 {
+		return
+	}
+	l.pending = append(l.pending[:0], l.pending[n:]...)
+	if err := l.buf.Flush(); err != nil && l.err == nil {
+		l.err = err
+	}
+}
+
+func (l *changeLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.writePending(true)
+	if err := l.buf.Flush(); err != nil && l.err == nil {
+		l.err = err
+	}
+	if err := l.f.Close(); err != nil && l.err == nil {
+		l.err = err
+	}
+	return l.err
+}
+
+// lastCommitTS returns the commit ts of the last transaction of the
+// connection.
+func lastCommitTS(ctx context.Context, conn *sql.Conn) (uint64, error) {
+	var info string
+	if err := conn.QueryRowContext(ctx, "SELECT @@tidb_last_txn_info").Scan(&info); err != nil {
+		return 0, err
+	}
+	var txn struct {
+		CommitTS uint64 `json:"commit_ts"`
+	}
+	if err := json.Unmarshal([]byte(info), &txn); err != nil {
+		return 0, fmt.Errorf("invalid last transaction info %q: %v", info, err)
+	}
+	return txn.CommitTS, nil
+}
+
+// inTxn executes the mutation in a transaction, and logs the changes returned
+// by the mutation with the commit ts if the change log is enabled.
+func (st *streamState) inTxn(ctx context.Context, s *bookState, fn func(tx *sql.Tx) ([]Change, error)) error {
+	if st.log == nil {
+		return inTxn(ctx, s, func(tx *sql.Tx) error {
+			_, err := fn(tx)
+			return err
+		})
+	}
+
+	tx, err := s.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	var startTS uint64
+	if err := tx.QueryRowContext(ctx, "SELECT @@tidb_current_ts").Scan(&startTS); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	st.log.begin(startTS)
+
+	changes, err := fn(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		st.log.finish(startTS, 0, nil)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		st.log.finish(startTS, 0, nil)
+		return err
+	}
+
+	// The changes are committed, so the failure of logging them is not the
+	// failure of the mutation.
+	commitTS, err := lastCommitTS(ctx, s.Conn)
+	if err != nil {
+		st.log.finish(startTS, 0, nil)
+		st.log.fail(fmt.Errorf("failed to get the commit ts: %v", err))
+		return nil
+	}
+	st.log.finish(startTS, commitTS, changes)
+	return nil
+}
+
+// Stream keeps mutating the tables at the rates until the context is done:
+// the inserts are new orders and users, the updates are stock changes and
+// rating edits, and the deletes are user deletions cascading to their orders
+// and ratings.
+func (w *Workloader) Stream(ctx context.Context, sc StreamConfig) error {
+	userIDs, err := w.queryIDs(ctx, tableUsers)
+	if err != nil {
+		return err
+	}
+	st := &streamState{users: newIDPool(userIDs)}
+	if st.bookIDs, err = w.queryIDs(ctx, tableBooks); err != nil {
+		return err
+	}
+	if len(userIDs) == 0 || len(st.bookIDs) == 0 {
+		return fmt.Errorf("no users or books found, please prepare the data first")
+	}
+	if st.serverAssignedUserID, err = w.serverAssignedID(ctx, tableUsers); err != nil {
+		return err
+	}
+	if st.serverAssignedOrderID, err = w.serverAssignedID(ctx, tableOrders); err != nil {
+		return err
+	}
+
+	if sc.ChangeLog != "" {
+		// The changes are ordered by the commit ts of TiDB.
+		var info sql.NullString
+		if err := w.db.QueryRowContext(ctx, "SELECT @@tidb_last_txn_info").Scan(&info); err != nil {
+			return fmt.Errorf("the change log needs the commit ts of TiDB: %v", err)
+		}
+		if st.log, err = openChangeLog(sc.ChangeLog); err != nil {
+			return err
+		}
+		w.log.Infof("Writing the changes into %s.", sc.ChangeLog)
+	}
+
+	threads := sc.Threads
+	if threads <= 0 {
+		threads = DefaultStreamThreads
+	}
+
+	kinds := []struct {
+		rate float64
+		pick func() streamOp
+	}{
+		{sc.Inserts, func() streamOp {
+			// Most of the inserts are orders, the new users replenish the
+			// deleted users.
+			if rand.IntRange(0, 9) == 0 {
+				return streamOp{name: streamInsertUser, run: st.insertUser}
+			}
+			return streamOp{name: streamInsertOrder, run: st.insertOrder}
+		}},
+		{sc.Updates, func() streamOp {
+			if rand.Bool() {
+				return streamOp{name: streamUpdateRating, run: st.updateRating}
+			}
+			return streamOp{name: streamUpdateStock, run: st.updateStock}
+		}},
+		{sc.Deletes, func() streamOp {
+			return streamOp{name: streamDeleteUser, run: st.deleteUser}
+		}},
+	}
+
+	w.measurement.Reset()
+	var wg sync.WaitGroup
+	for _, kind := range kinds {
+		if kind.rate <= 0 {
+			continue
+		}
+		limiter := rate.NewLimiter(rate.Limit(kind.rate), 1)
+		pick := kind.pick
+		for i := 0; i < threads; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				w.streamThread(ctx, st, limiter, pick)
+			}()
+		}
+	}
+	wg.Wait()
+
+	if st.log != nil {
+		return st.log.close()
+	}
+	return nil
+}
+
+func (w *Workloader) streamThread(ctx context.Context, st *streamState, limiter *rate.Limiter,
+	pick func() streamOp) {
+	threadCtx, err := w.InitThread(ctx)
+	if err != nil {
+		w.log.WithError(err).Error("failed to init the stream thread")
+		return
+	}
+	defer w.CleanupThread(threadCtx)
+	s, err := getBookState(threadCtx)
+	if err != nil {
+		w.log.WithError(err).Error("failed to init the stream thread")
+		return
+	}
+
+	for ctx.Err() == nil {
+		if err := limiter.Wait(ctx); err != nil {
+			return
+		}
+
+		op := pick()
+		start := time.Now()
+		// The committed changes are logged even if the stream is stopped.
+		err := op.run(threadCtx, s)
+		if ctx.Err() != nil {
+			return
+		}
+		w.measurement.Measure(op.name, time.Since(start), err)
+
+		if err != nil {
+			w.log.WithError(err).Debugf("failed to execute %s", op.name)
+			if refreshErr := w.refreshBadConn(threadCtx, s, err); refreshErr != nil {
+				w.log.WithError(refreshErr).Warn("failed to refresh the database connection")
+				return
+			}
+		}
+	}
+}
+
+// insertRow inserts a row and returns its id, which is assigned by the server
+// or generated randomly.
+func insertRow(ctx context.Context, tx *sql.Tx, serverAssigned bool, tableName, columns string,
+	values ...interface{}) (int64, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+	if serverAssigned {
+		res, err := tx.ExecContext(ctx,
+			fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", tableName, columns, placeholders), values...)
+		if err != nil {
+			return 0, err
+		}
+		return res.LastInsertId()
+	}
+
+	id := int64(rand.UintRange(minRandomID, maxRandomID))
+	_, err := tx.ExecContext(ctx,
+		fmt.Sprintf("INSERT INTO %s (id, %s) VALUES (?, %s)", tableName, columns, placeholders),
+		append([]interface{}{id}, values...)...)
+	return id, err
+}
+
+// deleted returns the change of the deleted row.
+func deleted(tableName string, pk map[string]interface{}) Change {
+	return Change{Op: changeDelete, Table: tableName, PK: pk}
+}
+
+// change returns the change of the inserted or updated row, with the
+// after-image read in the transaction.
+func (st *streamState) change(ctx context.Context, tx *sql.Tx, op, tableName string,
+	pk map[string]interface{}) (Change, error) {
+	c := Change{Op: op, Table: tableName, PK: pk}
+
+	columns := make([]string, 0, len(pk))
+	args := make([]interface{}, 0, len(pk))
+	for column, value := range pk {
+		columns = append(columns, column+" = ?")
+		args = append(args, value)
+	}
+	query := fmt.Sprintf("SELECT * FROM %s WHERE %s", tableName, strings.Join(columns, " AND "))
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return c, err
+	}
+	defer rows.Close()
+
+	names, err := rows.Columns()
+	if err != nil {
+		return c, err
+	}
+	if !rows.Next() {
+		return c, fmt.Errorf("the changed row of %s is not found: %v", tableName, pk)
+	}
+	values := make([]sql.NullString, len(names))
+	dest := make([]interface{}, len(names))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return c, err
+	}
+
+	c.After = make(map[string]interface{}, len(names))
+	for i, name := range names {
+		if values[i].Valid {
+			c.After[name] = values[i].String
+		} else {
+			c.After[name] = nil
+		}
+	}
+	return c, rows.Err()
+}
+
+// changes returns the changes of the rows if the change log is enabled.
+func (st *streamState) changes(ctx context.Context, tx *sql.Tx, op, tableName string,
+	pks ...map[string]interface{}) ([]Change, error) {
+	if st.log == nil {
+		return nil, nil
+	}
+	changes := make([]Change, 0, len(pks))
+	for _, pk := range pks {
+		c, err := st.change(ctx, tx, op, tableName, pk)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// insertOrder places a new order of a random user and book.
+func (st *streamState) insertOrder(ctx context.Context, s *bookState) error {
+	userID, ok := st.users.random()
+	if !ok {
+		return nil
+	}
+	bookID := st.bookIDs[rand.IntRange(0, len(st.bookIDs)-1)]
+
+	return st.inTxn(ctx, s, func(tx *sql.Tx) ([]Change, error) {
+		// The ordered_at column is filled by the server.
+		id, err := insertRow(ctx, tx, st.serverAssignedOrderID, tableOrders, "book_id, user_id, quality",
+			bookID, userID, rand.IntRange(1, 10))
+		if err != nil {
+			return nil, err
+		}
+		return st.changes(ctx, tx, changeInsert, tableOrders, map[string]interface{}{"id": id})
+	})
+}
+
+// insertUser registers a new user.
+func (st *streamState) insertUser(ctx context.Context, s *bookState) error {
+	nickname := fmt.Sprintf("%s%d", rand.Username(), rand.Number(1000, 999999))
+
+	var id int64
+	err := st.inTxn(ctx, s, func(tx *sql.Tx) ([]Change, error) {
+		var err error
+		id, err = insertRow(ctx, tx, st.serverAssignedUserID, tableUsers, "nickname, balance",
+			nickname, fmt.Sprintf("%.2f", rand.Float64Range(100, 10000)))
+		if err != nil {
+			return nil, err
+		}
+		return st.changes(ctx, tx, changeInsert, tableUsers, map[string]interface{}{"id": id})
+	})
+	if err == nil {
+		st.users.add(id)
+	}
+	return err
+}
+
+// updateStock restocks or sells some copies of a random book.
+func (st *streamState) updateStock(ctx context.Context, s *bookState) error {
+	bookID := st.bookIDs[rand.IntRange(0, len(st.bookIDs)-1)]
+
+	return st.inTxn(ctx, s, func(tx *sql.Tx) ([]Change, error) {
+		if _, err := tx.ExecContext(ctx, "UPDATE books SET stock = GREATEST(stock + ?, 0) WHERE id = ?",
+			rand.IntRange(-10, 50), bookID); err != nil {
+			return nil, err
+		}
+		return st.changes(ctx, tx, changeUpdate, tableBooks, map[string]interface{}{"id": bookID})
+	})
+}
+
+// updateRating edits the score of a rating of a random user, or rates a book
+// if the user has no rating.
+func (st *streamState) updateRating(ctx context.Context, s *bookState) error {
+	userID, ok := st.users.random()
+	if !ok {
+		return nil
+	}
+
+	return st.inTxn(ctx, s, func(tx *sql.Tx) ([]Change, error) {
+		var bookID int64
+		err := tx.QueryRowContext(ctx, "SELECT book_id FROM ratings WHERE user_id = ? LIMIT 1", userID).Scan(&bookID)
+		switch {
+		case err == sql.ErrNoRows:
+			bookID = st.bookIDs[rand.IntRange(0, len(st.bookIDs)-1)]
+		case err != nil:
+			return nil, err
+		}
+
+		// The ratings are only partitioned by book_id, so (book_id, user_id)
+		// is the primary key.
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO ratings (book_id, user_id, score, rated_at) VALUES (?, ?, ?, NOW())
+			ON DUPLICATE KEY UPDATE score = VALUES(score), rated_at = VALUES(rated_at)
+		`, bookID, userID, rand.IntRange(0, 5)); err != nil {
+			return nil, err
+		}
+		return st.changes(ctx, tx, changeUpdate, tableRatings,
+			map[string]interface{}{"book_id": bookID, "user_id": userID})
+	})
+}
+
+// deleteUser deletes a random user with the orders and ratings of the user,
+// which are deleted explicitly so that they are logged with or without the
+// foreign keys.
+func (st *streamState) deleteUser(ctx context.Context, s *bookState) error {
+	userID, ok := st.users.take()
+	if !ok {
+		return nil
+	}
+
+	err := st.inTxn(ctx, s, func(tx *sql.Tx) ([]Change, error) {
+		var changes []Change
+		if st.log != nil {
+			orderIDs, err := queryInt64s(ctx, tx, "SELECT id FROM orders WHERE user_id = ?", userID)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range orderIDs {
+				changes = append(changes, deleted(tableOrders, map[string]interface{}{"id": id}))
+			}
+
+			bookIDs, err := queryInt64s(ctx, tx, "SELECT book_id FROM ratings WHERE user_id = ?", userID)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range bookIDs {
+				changes = append(changes, deleted(tableRatings, map[string]interface{}{"book_id": id, "user_id": userID}))
+			}
+		}
+
+		for _, query := range []string{
+			"DELETE FROM orders WHERE user_id = ?",
+			"DELETE FROM ratings WHERE user_id = ?",
+			"DELETE FROM users WHERE id = ?",
+		} {
+			if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+				return nil, err
+			}
+		}
+		if st.log != nil {
+			changes = append(changes, deleted(tableUsers, map[string]interface{}{"id": userID}))
+		}
+		return changes, nil
+	})
+	if err != nil {
+		// The user is still alive.
+		st.users.add(userID)
+	}
+	return err
+}
+
+func queryInt64s(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []int64
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
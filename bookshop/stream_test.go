@@ -0,0 +1,147 @@
+package bookshop
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// logStep is a call of the change log, begin if commitTS is 0 and finished
+// is false, or else finish.
+type logStep struct {
+	startTS  uint64
+	commitTS uint64
+	finished bool
+	// written are the commit ts of the lines written after the step.
+	written []uint64
+}
+
+func begin(startTS uint64, written ...uint64) logStep {
+	return logStep{startTS: startTS, written: written}
+}
+
+func commit(startTS, commitTS uint64, written ...uint64) logStep {
+	return logStep{startTS: startTS, commitTS: commitTS, finished: true, written: written}
+}
+
+func rollback(startTS uint64, written ...uint64) logStep {
+	return logStep{startTS: startTS, finished: true, written: written}
+}
+
+func TestChangeLogOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []logStep
+		// closed are the commit ts of the lines written after closing.
+		closed []uint64
+	}{
+		{
+			name:   "sequential",
+			steps:  []logStep{begin(10), commit(10, 11, 11), begin(12, 11), commit(12, 13, 11, 13)},
+			closed: []uint64{11, 13},
+		},
+		{
+			name: "held back by the earlier transaction in flight",
+			steps: []logStep{
+				begin(10), begin(20), commit(20, 25), commit(10, 30, 25, 30),
+			},
+			closed: []uint64{25, 30},
+		},
+		{
+			name: "committed out of order",
+			steps: []logStep{
+				begin(10), begin(15), begin(20),
+				commit(20, 22),
+				commit(10, 24),
+				commit(15, 18, 18, 22, 24),
+			},
+			closed: []uint64{18, 22, 24},
+		},
+		{
+			name: "written up to the transaction in flight",
+			steps: []logStep{
+				begin(10), commit(10, 12, 12),
+				begin(15, 12), begin(20, 12),
+				commit(20, 22, 12),
+				begin(30, 12),
+				commit(15, 18, 12, 18, 22),
+				commit(30, 31, 12, 18, 22, 31),
+			},
+			closed: []uint64{12, 18, 22, 31},
+		},
+		{
+			name: "rolled back",
+			steps: []logStep{
+				begin(10), begin(11), commit(11, 14), rollback(10, 14),
+			},
+			closed: []uint64{14},
+		},
+		{
+			name: "same start ts",
+			steps: []logStep{
+				begin(10), begin(10), commit(10, 12), commit(10, 11, 11, 12),
+			},
+			closed: []uint64{11, 12},
+		},
+		{
+			name:   "written on close",
+			steps:  []logStep{begin(10), begin(20), commit(20, 21)},
+			closed: []uint64{21},
+		},
+	}
+
+	dir := t.TempDir()
+	for i, tt := range tests {
+		path := filepath.Join(dir, fmt.Sprintf("changes%d.log", i))
+		l, err := openChangeLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j, step := range tt.steps {
+			switch {
+			case !step.finished:
+				l.begin(step.startTS)
+			case step.commitTS == 0:
+				l.finish(step.startTS, 0, nil)
+			default:
+				l.finish(step.startTS, step.commitTS, []Change{{Op: "update", Table: tableBooks}})
+			}
+			if got := readCommitTS(t, path); !reflect.DeepEqual(got, step.written) {
+				t.Errorf("%s: step %d wrote %v, want %v", tt.name, j+1, got, step.written)
+			}
+		}
+		if err := l.close(); err != nil {
+			t.Fatalf("%s: close failed: %v", tt.name, err)
+		}
+		if got := readCommitTS(t, path); !reflect.DeepEqual(got, tt.closed) {
+			t.Errorf("%s: closed with %v, want %v", tt.name, got, tt.closed)
+		}
+	}
+}
+
+// readCommitTS reads the commit ts of the lines of the change log.
+func readCommitTS(t *testing.T, path string) []uint64 {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var result []uint64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var c Change
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, c.CommitTS)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
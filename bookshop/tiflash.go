@@ -0,0 +1,144 @@
+package bookshop
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Mini256/tidb-dataset/pkg/query"
+	"github.com/Mini256/tidb-dataset/pkg/util"
+)
+
+const (
+	// DefaultTiFlashTimeout is the maximum time waiting for the TiFlash
+	// replicas to be available.
+	DefaultTiFlashTimeout = 30 * time.Minute
+
+	tiflashPollInterval = 3 * time.Second
+)
+
+// setupTiFlash creates the TiFlash replicas of the tables, waits for them to
+// be available, and then compares the analytical queries on both engines.
+func (w *Workloader) setupTiFlash(ctx context.Context) error {
+	s, err := getBookState(ctx)
+	if err != nil {
+		return err
+	}
+
+	tables := w.cfg.TiFlashTables
+	if len(tables) == 0 {
+		tables = tableNames
+	}
+
+	for _, tableName := range tables {
+		query := fmt.Sprintf("ALTER TABLE %s SET TIFLASH REPLICA %d;", tableName, w.cfg.TiFlashReplicas)
+		w.log.Printf("Setting %d TiFlash replicas for table %s.\n", w.cfg.TiFlashReplicas, tableName)
+		if w.script != nil {
+			if err := w.script.WriteStatement(query); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := s.Conn.ExecContext(ctx, query); err != nil {
+			return &SchemaError{Err: err}
+		}
+	}
+	if w.script != nil {
+		// The replicas are not synced and compared in the script.
+		return nil
+	}
+
+	if err := w.waitTiFlashReplicas(ctx, tables); err != nil {
+		return err
+	}
+
+	return w.compareEngines(ctx)
+}
+
+// waitTiFlashReplicas polls the replica status until all the replicas of the
+// tables are available and fully synced.
+func (w *Workloader) waitTiFlashReplicas(ctx context.Context, tables []string) error {
+	s, err := getBookState(ctx)
+	if err != nil {
+		return err
+	}
+
+	timeout := w.cfg.TiFlashTimeout
+	if timeout <= 0 {
+		timeout = DefaultTiFlashTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*), COALESCE(SUM(available), 0), COALESCE(SUM(progress), 0)
+		FROM information_schema.tiflash_replica
+		WHERE table_schema = ? AND table_name IN ('%s')
+	`, strings.Join(tables, "', '"))
+
+	bar := util.NewProgressBar(os.Stdout, "Syncing TiFlash replicas")
+	defer bar.Finish()
+
+	ticker := time.NewTicker(tiflashPollInterval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	for {
+		var (
+			total     int
+			available int
+			progress  float64
+		)
+		if err := s.Conn.QueryRowContext(ctx, query, w.cfg.DBName).Scan(&total, &available, &progress); err != nil {
+			return err
+		}
+		if total > 0 {
+			bar.Update(progress/float64(total), fmt.Sprintf("%d/%d tables available", available, total))
+		}
+		if total == len(tables) && available == total && progress >= float64(total) {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return fmt.Errorf("the TiFlash replicas are not available after %s", timeout)
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	w.log.Infof("TiFlash replicas are available after %s!", time.Since(start).Round(time.Second))
+	return nil
+}
+
+// compareEngines runs the analytical queries on TiKV and TiFlash and prints
+// the timing comparison.
+func (w *Workloader) compareEngines(ctx context.Context) error {
+	s, err := getBookState(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "QUERY\tTIKV\tTIFLASH\tSPEEDUP")
+	for _, q := range w.Queries() {
+		w.log.Infof("Running query %s on TiKV and TiFlash...", q.Name)
+		tikv, err := query.Run(ctx, s.Conn, q.WithStorageHint(engineTiKV))
+		if err != nil {
+			return fmt.Errorf("failed to run query %s on TiKV: %v", q.Name, err)
+		}
+		tiflash, err := query.Run(ctx, s.Conn, q.WithStorageHint(engineTiFlash))
+		if err != nil {
+			return fmt.Errorf("failed to run query %s on TiFlash: %v", q.Name, err)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.2fx\n", q.Name, tikv.Elapsed.Round(time.Millisecond),
+			tiflash.Elapsed.Round(time.Millisecond), tikv.Elapsed.Seconds()/tiflash.Elapsed.Seconds())
+	}
+
+	return tw.Flush()
+}
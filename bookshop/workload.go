@@ -4,11 +4,48 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	mathrand "math/rand"
+	"time"
 
+	"github.com/Mini256/tidb-dataset/pkg/db"
+	"github.com/Mini256/tidb-dataset/pkg/measurement"
 	"github.com/Mini256/tidb-dataset/pkg/workload"
 	"github.com/sirupsen/logrus"
 )
 
+// PKStrategy is the way to generate the ids of the tables whose primary key
+// is a single id column.
+type PKStrategy string
+
+const (
+	// PKClientRandom inserts the random ids generated by the client.
+	PKClientRandom PKStrategy = "client-random"
+	// PKAutoIncrement lets the server assign the ids with AUTO_INCREMENT.
+	PKAutoIncrement PKStrategy = "auto-increment"
+	// PKAutoRandom lets the server assign the ids with AUTO_RANDOM.
+	PKAutoRandom PKStrategy = "auto-random"
+	// PKShardRowIDBits uses the AUTO_INCREMENT ids on the nonclustered
+	// primary key, and scatters the rows with SHARD_ROW_ID_BITS.
+	PKShardRowIDBits PKStrategy = "nonclustered+shard_row_id_bits"
+)
+
+// PKStrategies lists all the supported primary key strategies.
+var PKStrategies = []PKStrategy{PKClientRandom, PKAutoIncrement, PKAutoRandom, PKShardRowIDBits}
+
+// ServerAssignedID tells whether the ids are assigned by the database server.
+func (s PKStrategy) ServerAssignedID() bool {
+	return s == PKAutoIncrement || s == PKAutoRandom || s == PKShardRowIDBits
+}
+
+func (s PKStrategy) validate() error {
+	for _, strategy := range PKStrategies {
+		if s == strategy {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown primary key strategy %q, available: %v", s, PKStrategies)
+}
+
 // Config is the configuration for book demo workload.
 type Config struct {
 	DBName      string
@@ -18,14 +55,77 @@ type Config struct {
 	BookCount   int
 	OrderCount  int
 	RatingCount int
+	ForeignKeys bool
+	PKStrategy  PKStrategy
+	Partitions  PartitionSpecs
+	// GlobalIndex creates a global unique index on the id of the partitioned
+	// orders, whose primary key includes the partitioning column (TiDB only).
+	GlobalIndex bool
+
+	// BatchSize is the number of the rows of each INSERT statement of
+	// prepare, 0 means the default.
+	BatchSize int
+	// Seed is the seed of the random rows of prepare, the same seed
+	// generates the same rows with the same config on the same UTC day, as
+	// the orders and the ratings go up to the day, except the ids assigned
+	// by the server. 0 means a random seed.
+	Seed int64
+
+	// PartitionFutureMonths is the number of months created ahead for the
+	// range-month partitioned tables, and PartitionRetentionMonths is the
+	// number of months kept by the partition rotation, 0 means keeping all.
+	PartitionFutureMonths    int
+	PartitionRetentionMonths int
+
+	// PreSplit splits the regions of the tables before loading data, with
+	// about SplitRowsPerRegion rows planned in each region.
+	PreSplit           bool
+	SplitRowsPerRegion int
+
+	// TiFlashReplicas is the number of TiFlash replicas created for the
+	// TiFlashTables after loading data, 0 means no TiFlash replica.
+	TiFlashReplicas int
+	TiFlashTables   []string
+	TiFlashTimeout  time.Duration
+
+	// Profile is the name of a built-in profile or the path of a custom YAML
+	// profile of the run workload.
+	Profile string
+
+	// Scenario replaces the transactions of the profile with a dedicated
+	// scenario of the run, e.g. hot-book with HotBooks bestsellers, or bank
+	// with the total balance checked every VerifyInterval.
+	Scenario       string
+	HotBooks       int
+	VerifyInterval time.Duration
 }
 
 // Workloader is book demo workload.
 type Workloader struct {
-	db         *sql.DB
-	log        *logrus.Entry
-	cfg        Config
-	ddlManager *ddlManager
+	db          *sql.DB
+	log         *logrus.Entry
+	cfg         Config
+	ddlManager  *ddlManager
+	measurement *measurement.Measurement
+
+	// script receives the statements of prepare instead of the database,
+	// which is set by NewScriptWorkloader.
+	script *db.ScriptWriter
+	// sink receives the rows of the tables instead of the database, which
+	// is set by NewExportWorkloader.
+	sink RowSink
+	// dataTimeEnd is the latest time of the generated rows.
+	dataTimeEnd time.Time
+
+	// The state of the run workload, which is initialized by InitRun.
+	runTxns []txn
+	run     *runState
+
+	// txnMode is the tidb_txn_mode of the sessions created by InitThread,
+	// empty means the default mode of the server.
+	txnMode    string
+	readMode   ReadMode
+	contention contention
 }
 
 type contextKey string
@@ -34,25 +134,83 @@ const stateKey = contextKey("book")
 
 type bookState struct {
 	*workload.DatasetState
+
+	// The Zipfian generators of the indexes of the accessed users and books,
+	// which are nil for the uniform access.
+	userZipf *mathrand.Zipf
+	bookZipf *mathrand.Zipf
+}
+
+func getBookState(ctx context.Context) (*bookState, error) {
+	s, ok := ctx.Value(stateKey).(*bookState)
+	if !ok {
+		return nil, errNoThreadState
+	}
+	return s, nil
+}
+
+func NewWorkloader(sqlDB *sql.DB, cfg Config) (*Workloader, error) {
+	if sqlDB == nil {
+		return nil, &db.ConnError{Err: fmt.Errorf("no database connection")}
+	}
+	return newWorkloader(sqlDB, cfg, nil)
+}
+
+// NewScriptWorkloader creates the workloader writing the statements of
+// prepare into the script instead of executing them, without connecting to
+// the database. The ids assigned by the server are assumed to be 1 to the
+// number of the rows of each table.
+func NewScriptWorkloader(cfg Config, script *db.ScriptWriter) (*Workloader, error) {
+	return newWorkloader(nil, cfg, script)
 }
 
-func getBookState(ctx context.Context) *bookState {
-	s := ctx.Value(stateKey).(*bookState)
-	return s
+// NewExportWorkloader creates the workloader writing the generated rows of the
+// tables into the sink by Export, without connecting to the database. The ids
+// assigned by the server are assumed to be 1 to the number of the rows of
+// each table.
+func NewExportWorkloader(cfg Config, sink RowSink) (*Workloader, error) {
+	w, err := newWorkloader(nil, cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	w.sink = sink
+	return w, nil
 }
 
-func NewWorkloader(db *sql.DB, cfg Config) (*Workloader, error) {
-	if db == nil {
-		panic(fmt.Errorf("failed to connect to database when loading data"))
+func newWorkloader(sqlDB *sql.DB, cfg Config, script *db.ScriptWriter) (*Workloader, error) {
+	if cfg.PKStrategy == "" {
+		cfg.PKStrategy = PKClientRandom
+	}
+	if err := cfg.PKStrategy.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.ForeignKeys && len(cfg.Partitions) > 0 {
+		return nil, fmt.Errorf("foreign keys are not supported on the partitioned tables")
+	}
+	if err := cfg.validateGlobalIndex(); err != nil {
+		return nil, err
+	}
+	for _, tableName := range cfg.TiFlashTables {
+		if !isTableName(tableName) {
+			return nil, fmt.Errorf("unknown table %s for TiFlash replicas", tableName)
+		}
+	}
+	if err := validateScenario(cfg.Scenario); err != nil {
+		return nil, err
+	}
+	if cfg.HotBooks <= 0 {
+		cfg.HotBooks = DefaultHotBooks
 	}
 
 	logger := logrus.WithField("dataset", "bookshop")
 
 	w := &Workloader{
-		db:         db,
-		cfg:        cfg,
-		log:        logger,
-		ddlManager: newDDLManager(logger),
+		db:          sqlDB,
+		cfg:         cfg,
+		log:         logger,
+		ddlManager:  newDDLManager(logger, cfg, script),
+		measurement: measurement.NewMeasurement(),
+		script:      script,
 	}
 
 	return w, nil
@@ -67,18 +225,47 @@ func (w *Workloader) DBName() string {
 }
 
 // InitThread inits thread.
-func (w *Workloader) InitThread(ctx context.Context) context.Context {
-	s := &bookState{
-		DatasetState: workload.NewDatasetState(ctx, w.db),
+func (w *Workloader) InitThread(ctx context.Context) (context.Context, error) {
+	state, err := workload.NewDatasetState(ctx, w.db)
+	if err != nil {
+		return ctx, err
+	}
+	s := &bookState{DatasetState: state}
+	if s.Conn == nil {
+		// The script workloader has no connection.
+		return context.WithValue(ctx, stateKey, s), nil
+	}
+	w.initSession(ctx, s.Conn)
+	if w.run != nil && w.run.profile.Skew > 0 {
+		r := mathrand.New(mathrand.NewSource(time.Now().UnixNano()))
+		s.userZipf = mathrand.NewZipf(r, w.run.profile.Skew, 1, uint64(len(w.run.userIDs)-1))
+		s.bookZipf = mathrand.NewZipf(r, w.run.profile.Skew, 1, uint64(len(w.run.bookIDs)-1))
 	}
 	ctx = context.WithValue(ctx, stateKey, s)
 
-	return ctx
+	return ctx, nil
+}
+
+// initSession sets the transaction mode and the read mode of the session,
+// which is done again when the connection is replaced.
+func (w *Workloader) initSession(ctx context.Context, conn *sql.Conn) {
+	if w.txnMode != "" {
+		if _, err := conn.ExecContext(ctx, "SET SESSION tidb_txn_mode = ?", w.txnMode); err != nil {
+			w.log.WithError(err).Warnf("failed to set the transaction mode %s", w.txnMode)
+		}
+	}
+	if err := w.applyReadMode(ctx, conn); err != nil {
+		w.log.WithError(err).Warnf("failed to set the read mode %s", w.readMode)
+	}
 }
 
 // CleanupThread implements Workloader interface.
 func (w *Workloader) CleanupThread(ctx context.Context) {
-	s := getBookState(ctx)
+	s, err := getBookState(ctx)
+	if err != nil {
+		w.log.WithError(err).Warn("failed to clean up the thread")
+		return
+	}
 	if s.Conn != nil {
 		err := s.Conn.Close()
 		if err != nil {
@@ -92,10 +279,13 @@ func (w *Workloader) CleanupThread(ctx context.Context) {
 
 // Prepare implements Workloader interface.
 func (w *Workloader) Prepare(ctx context.Context) error {
-	s := getBookState(ctx)
+	s, err := getBookState(ctx)
+	if err != nil {
+		return err
+	}
 
-	if w.db == nil || s.Conn == nil {
-		return fmt.Errorf("failed to connect the database")
+	if w.script == nil && (w.db == nil || s.Conn == nil) {
+		return &db.ConnError{Err: fmt.Errorf("no database connection")}
 	}
 
 	// Drop the old table if it needs.
@@ -113,20 +303,38 @@ func (w *Workloader) Prepare(ctx context.Context) error {
 	}
 
 	w.log.Info("Clearing the old data....")
-	for _, tableName := range tableNames {
-		query := fmt.Sprintf("TRUNCATE TABLE %s;", tableName)
-		_, err := s.Conn.ExecContext(ctx, query)
-		if err != nil {
+	if err := w.ddlManager.truncateTables(ctx); err != nil {
+		return err
+	}
+
+	// TRUNCATE TABLE recreates the tables, so split the regions after that.
+	if w.cfg.PreSplit {
+		w.log.Info("Splitting the regions of the tables....")
+		if err := w.ddlManager.splitRegions(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := w.loadTables(ctx); err != nil {
+		return err
+	}
+
+	if w.cfg.TiFlashReplicas > 0 {
+		w.log.Info("Setting up the TiFlash replicas....")
+		if err := w.setupTiFlash(ctx); err != nil {
 			return err
 		}
 	}
 
-	return prepareWorkload(ctx, w.log, w)
+	return nil
 }
 
-func (w *Workloader) Run(_ context.Context) error {
-	// TODO implement me
-	panic("implement me")
+// Export writes the generated rows of the tables into the sink.
+func (w *Workloader) Export(ctx context.Context) error {
+	if w.sink == nil {
+		return fmt.Errorf("no sink of the rows")
+	}
+	return w.loadTables(ctx)
 }
 
 func (w *Workloader) Cleanup(ctx context.Context) error {
@@ -3,9 +3,11 @@ package main
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 
 	"github.com/Mini256/tidb-dataset/bookshop"
 	"github.com/Mini256/tidb-dataset/pkg/db"
+	"github.com/Mini256/tidb-dataset/pkg/metrics"
 	"github.com/Mini256/tidb-dataset/pkg/workload"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -15,44 +17,109 @@ const DefaultDBName = "bookshop"
 
 var cfg bookshop.Config
 
+// readModes are the read modes compared by the run command.
+var readModes []string
+
 func executeBookshop(action string) error {
 	log := logrus.WithField("dataset", "bookshop")
 
+	if action == "prepare" && exportCfg.format != "" {
+		if dryRunCfg.enabled {
+			return usageErrorf("--dry-run cannot be used with --format")
+		}
+		if err := executeExport(globalCtx); err != nil {
+			return fmt.Errorf("failed to export the data: %w", err)
+		}
+		return nil
+	}
+	if action == "prepare" && dryRunCfg.enabled {
+		if err := executeDryRun(globalCtx); err != nil {
+			return fmt.Errorf("failed to execute prepare dry run: %w", err)
+		}
+		return nil
+	}
+
 	var (
 		globalDB *sql.DB
 		err      error
 	)
 
 	// Init database connection.
-	globalDB, err = db.OpenDB(cfg.DBName, host, port, user, password)
+	opts, err := connOptions(cfg.DBName)
 	if err != nil {
-		db.CloseDB(globalDB)
-		log.WithError(err).Errorf("cannot open database, please check it (ip/port/username/password)")
-		return nil
+		return err
+	}
+	globalDB, err = db.OpenDB(opts)
+	if err != nil {
+		return fmt.Errorf("cannot open database, please check it (ip/port/username/password): %w", err)
 	}
 	defer db.CloseDB(globalDB)
+	metrics.RegisterDB(globalDB)
 
 	// Init context state for current thread.
-	var w workload.Workloader
-	w, err = bookshop.NewWorkloader(globalDB, cfg)
+	bw, err := bookshop.NewWorkloader(globalDB, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to init work loader: %w", err)
+	}
+	var w workload.Workloader = bw
+
+	if action == "run" {
+		switch {
+		case cfg.Scenario != "" && len(readModes) > 0:
+			err = usageErrorf("--read-mode cannot be used with --scenario")
+		case runCfg.ddlScript != "" && (len(readModes) > 0 || cfg.Scenario == bookshop.ScenarioHotBook):
+			// The modes are run one by one, the steps of the DDL script
+			// would be executed again in each mode.
+			err = usageErrorf("--ddl-script cannot be used with --read-mode or the %s scenario",
+				bookshop.ScenarioHotBook)
+		case len(readModes) > 0:
+			err = executeReadModes(globalCtx, bw, readModes)
+		case cfg.Scenario == bookshop.ScenarioHotBook:
+			err = executeHotBook(globalCtx, bw)
+		case cfg.Scenario == bookshop.ScenarioBank:
+			err = executeBank(globalCtx, bw)
+		default:
+			err = executeRun(globalCtx, w)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to execute run command: %w", err)
+		}
+		log.Info("Finished!")
+		return nil
+	}
+
+	if action == "stream" {
+		if err := executeStream(globalCtx, bw); err != nil {
+			return fmt.Errorf("failed to execute stream command: %w", err)
+		}
+		log.Info("Finished!")
+		return nil
+	}
+
+	workerCtx, err := w.InitThread(globalCtx)
 	if err != nil {
-		panic(fmt.Errorf("failed to init work loader: %v", err))
+		return fmt.Errorf("failed to init the thread: %w", err)
 	}
+	defer w.CleanupThread(workerCtx)
 
-	workerCtx := w.InitThread(globalCtx)
 	switch action {
 	case "prepare":
-		err := w.Prepare(workerCtx)
-		if err != nil {
-			panic(fmt.Errorf("failed to execute prepare command: %v", err))
+		if err := w.Prepare(workerCtx); err != nil {
+			return fmt.Errorf("failed to execute prepare command: %w", err)
 		}
 	case "cleanup":
-		err := w.Cleanup(workerCtx)
-		if err != nil {
-			panic(fmt.Errorf("failed to execute cleanup command: %v", err))
+		if err := w.Cleanup(workerCtx); err != nil {
+			return fmt.Errorf("failed to execute cleanup command: %w", err)
+		}
+	case "partitions-rotate":
+		if err := bw.RotatePartitions(workerCtx); err != nil {
+			return fmt.Errorf("failed to execute partitions rotate command: %w", err)
+		}
+	case "query-run":
+		if err := runQueries(workerCtx, globalDB, w.Name(), w.Queries()); err != nil {
+			return fmt.Errorf("failed to execute query run command: %w", err)
 		}
 	}
-	w.CleanupThread(workerCtx)
 
 	log.Info("Finished!")
 
@@ -86,6 +153,78 @@ func registerBookshop(root *cobra.Command) {
 		"Specify the number of orders")
 	cmdPrepare.PersistentFlags().IntVar(&cfg.RatingCount, "ratings", bookshop.DefaultRatingCount,
 		"Specify the number of ratings")
+	cmdPrepare.PersistentFlags().BoolVar(&cfg.ForeignKeys, "foreign-keys", false,
+		"Create the tables with foreign key constraints")
+	cmdPrepare.PersistentFlags().StringVar((*string)(&cfg.PKStrategy), "pk-strategy", string(bookshop.PKClientRandom),
+		"Primary key strategy: client-random, auto-increment, auto-random, nonclustered+shard_row_id_bits")
+	cmdPrepare.PersistentFlags().Var(&cfg.Partitions, "partition",
+		"Partition the tables, e.g. orders:range-month,ratings:hash-16 (methods: range-month, hash-<n>, list)")
+	cmdPrepare.PersistentFlags().BoolVar(&cfg.GlobalIndex, "global-index", false,
+		"Create a global unique index on the id of the partitioned orders (TiDB v8.3+)")
+	cmdPrepare.PersistentFlags().IntVar(&cfg.PartitionFutureMonths, "partition-future-months",
+		bookshop.DefaultPartitionFutureMonths, "Number of months created ahead for the range-month partitions")
+	cmdPrepare.PersistentFlags().BoolVar(&cfg.PreSplit, "pre-split", false,
+		"Split the regions of the tables before loading data (TiDB only)")
+	cmdPrepare.PersistentFlags().IntVar(&cfg.SplitRowsPerRegion, "split-rows-per-region",
+		bookshop.DefaultSplitRowsPerRegion, "Number of rows planned in each region when pre-splitting the regions")
+	cmdPrepare.PersistentFlags().IntVar(&cfg.TiFlashReplicas, "tiflash-replicas", 0,
+		"Number of TiFlash replicas created after loading data, and compare the analytical queries on both engines")
+	cmdPrepare.PersistentFlags().StringSliceVar(&cfg.TiFlashTables, "tiflash-tables", nil,
+		"Tables with the TiFlash replicas (default all tables)")
+	cmdPrepare.PersistentFlags().DurationVar(&cfg.TiFlashTimeout, "tiflash-timeout", bookshop.DefaultTiFlashTimeout,
+		"Maximum time waiting for the TiFlash replicas to be available")
+	cmdPrepare.PersistentFlags().BoolVar(&dryRunCfg.enabled, "dry-run", false,
+		"Print the statements with a sample of the INSERT statements and the estimated rows and bytes, "+
+			"without connecting to the database")
+	cmdPrepare.PersistentFlags().StringVar(&dryRunCfg.output, "dry-run-output", "",
+		"Write the statements of the dry run into the file instead of the standard output")
+	cmdPrepare.PersistentFlags().Int64Var(&cfg.Seed, "seed", 0,
+		"Seed of the random data, the same seed generates the same rows with the same flags on the same UTC day, "+
+			"except the ids assigned by the server (default random)")
+	cmdPrepare.PersistentFlags().IntVar(&cfg.BatchSize, "batch-size", 0,
+		"Number of the rows of each INSERT statement (default 1024)")
+	cmdPrepare.PersistentFlags().StringVar(&exportCfg.format, "format", "",
+		"Write the data into the --output in the format instead of loading it into the database, sql or parquet")
+	cmdPrepare.PersistentFlags().StringVar(&exportCfg.output, "output", "",
+		"Output of --format, the file of the sql dump compressed if it ends with .gz or .zst, "+
+			"or the directory of the parquet files")
+	cmdPrepare.PersistentFlags().StringVar(&parquetCfg.compression, "parquet-compression", "snappy",
+		"Compression of the parquet files, one of "+parquetCompressionNames())
+	cmdPrepare.PersistentFlags().Int64Var(&parquetCfg.rowGroupSize, "parquet-row-group-size", defaultRowGroupSize,
+		"Size of the row groups of the parquet files in MiB")
+
+	var cmdRun = &cobra.Command{
+		Use:   "run",
+		Short: "Run the workload on the test data",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return executeBookshop("run")
+		},
+	}
+
+	registerRunFlags(cmdRun)
+	cmdRun.PersistentFlags().StringVar(&cfg.Profile, "profile", bookshop.DefaultProfile,
+		fmt.Sprintf("Workload profile, one of %s, or the path of a custom YAML profile",
+			profileNames(bookshop.Profiles())))
+	cmdRun.PersistentFlags().StringVar(&cfg.Scenario, "scenario", "",
+		fmt.Sprintf("Run a dedicated scenario instead of the profile transactions, one of %s",
+			strings.Join(bookshop.Scenarios, ", ")))
+	cmdRun.PersistentFlags().IntVar(&cfg.HotBooks, "hot-books", bookshop.DefaultHotBooks,
+		"Number of the bestsellers bought by the hot-book scenario")
+	cmdRun.PersistentFlags().DurationVar(&cfg.VerifyInterval, "verify-interval", bookshop.DefaultVerifyInterval,
+		"Interval of checking the total balance of the users in the bank scenario")
+	cmdRun.PersistentFlags().StringSliceVar(&readModes, "read-mode", nil,
+		"Read mode of the read transactions: leader, follower, stale:<duration> or as-of:<duration>, "+
+			"multiple modes are run one by one and compared")
+
+	var cmdStream = &cobra.Command{
+		Use:   "stream",
+		Short: "Keep inserting, updating and deleting the test data at the given rates, e.g. for the CDC demos",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return executeBookshop("stream")
+		},
+	}
+
+	registerStreamFlags(cmdStream)
 
 	var cmdCleanUp = &cobra.Command{
 		Use:   "cleanup",
@@ -95,8 +234,34 @@ func registerBookshop(root *cobra.Command) {
 		},
 	}
 
+	var cmdPartitions = &cobra.Command{
+		Use:   "partitions",
+		Short: "Manage the partitions of the partitioned tables",
+	}
+
+	var cmdPartitionsRotate = &cobra.Command{
+		Use:   "rotate",
+		Short: "Add the future partitions and drop the old partitions of the range-month partitioned tables",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return executeBookshop("partitions-rotate")
+		},
+	}
+
+	cmdPartitionsRotate.PersistentFlags().IntVar(&cfg.PartitionFutureMonths, "future-months",
+		bookshop.DefaultPartitionFutureMonths, "Number of months created ahead of the current month")
+	cmdPartitionsRotate.PersistentFlags().IntVar(&cfg.PartitionRetentionMonths, "retention-months", 0,
+		"Drop the partitions older than the number of months, 0 means keeping all")
+
+	cmdPartitions.AddCommand(cmdPartitionsRotate)
+
+	registerQuery(cmd, bookshop.Queries, executeBookshop)
+	registerDiff(cmd, bookshop.Tables)
+
 	cmd.AddCommand(cmdPrepare)
+	cmd.AddCommand(cmdRun)
+	cmd.AddCommand(cmdStream)
 	cmd.AddCommand(cmdCleanUp)
+	cmd.AddCommand(cmdPartitions)
 
 	root.AddCommand(cmd)
 }
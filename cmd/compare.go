@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Mini256/tidb-dataset/pkg/db"
+	"github.com/Mini256/tidb-dataset/pkg/query"
+	"github.com/spf13/cobra"
+)
+
+const defaultLatencyThreshold = 0.2
+
+func registerCompare(root *cobra.Command) {
+	var threshold float64
+
+	cmd := &cobra.Command{
+		Use:   "compare <old.json> <new.json>",
+		Short: "Compare the plans and latencies of the queries in two reports of the query run command",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return compareReports(args[0], args[1], threshold)
+		},
+	}
+
+	cmd.Flags().Float64Var(&threshold, "latency-threshold", defaultLatencyThreshold,
+		"Ratio of the latency increase regarded as a regression, e.g. 0.2 means 20%")
+
+	root.AddCommand(cmd)
+}
+
+func compareReports(oldFile, newFile string, threshold float64) error {
+	oldReport, err := query.ReadReport(oldFile)
+	if err != nil {
+		return fmt.Errorf("failed to read report %s: %v", oldFile, err)
+	}
+	newReport, err := query.ReadReport(newFile)
+	if err != nil {
+		return fmt.Errorf("failed to read report %s: %v", newFile, err)
+	}
+
+	fmt.Printf("Old: %s (%s)\n", oldFile, oldReport.ServerVersion)
+	fmt.Printf("New: %s (%s)\n\n", newFile, newReport.ServerVersion)
+
+	comparisons := query.Compare(oldReport, newReport, threshold)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "QUERY\tOLD (ms)\tNEW (ms)\tCHANGE\tPLAN\tSTATUS")
+	regressions, planChanges := 0, 0
+	for _, c := range comparisons {
+		switch {
+		case c.Old == nil:
+			fmt.Fprintf(tw, "%s\t-\t%.2f\t-\t-\tNEW\n", c.Name, c.New.LatencyMs)
+			continue
+		case c.New == nil:
+			fmt.Fprintf(tw, "%s\t%.2f\t-\t-\t-\tMISSING\n", c.Name, c.Old.LatencyMs)
+			continue
+		}
+
+		plan, status := "same", "OK"
+		if c.PlanChanged {
+			plan = "changed"
+			planChanges++
+		}
+		if c.Regressed {
+			status = "REGRESSED"
+			regressions++
+		}
+		fmt.Fprintf(tw, "%s\t%.2f\t%.2f\t%+.1f%%\t%s\t%s\n",
+			c.Name, c.Old.LatencyMs, c.New.LatencyMs, c.LatencyChange*100, plan, status)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, c := range comparisons {
+		if !c.PlanChanged {
+			continue
+		}
+		fmt.Printf("\n# Plan of %s changed\n", c.Name)
+		fmt.Println("--- old")
+		for _, line := range c.Old.PlanShape {
+			fmt.Println(line)
+		}
+		fmt.Println("+++ new")
+		for _, line := range c.New.PlanShape {
+			fmt.Println(line)
+		}
+	}
+
+	fmt.Printf("\n%d queries compared, %d plans changed, %d latencies regressed.\n",
+		len(comparisons), planChanges, regressions)
+	if regressions > 0 {
+		return &db.VerifyError{
+			Reason: fmt.Sprintf("%d queries regressed more than %.0f%%", regressions, threshold*100),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix is the prefix of the environment variables of the flags, e.g.
+// TIDB_DATASET_HOST for --host.
+const envPrefix = "TIDB_DATASET_"
+
+// Sources of the settings, in the order of the precedence.
+const (
+	sourceFlag    = "flag"
+	sourceEnv     = "env"
+	sourceConfig  = "config"
+	sourceDefault = "default"
+)
+
+// sourceRank returns the rank of the source in the precedence, the higher
+// source overrides the lower one.
+func sourceRank(source string) int {
+	switch source {
+	case sourceFlag:
+		return 3
+	case sourceEnv:
+		return 2
+	case sourceConfig:
+		return 1
+	default:
+		return 0
+	}
+}
+
+var (
+	configFile    string
+	configProfile string
+
+	// flagSources are the sources of the flags of the running command.
+	flagSources = make(map[string]string)
+)
+
+// secretFlags are masked by the config show command.
+var secretFlags = map[string]bool{"password": true}
+
+// dsnFlags are the DSNs, whose passwords are masked by the config show command.
+var dsnFlags = map[string]bool{"dsn": true, "upstream": true, "downstream": true}
+
+func registerConfig(root *cobra.Command) {
+	root.PersistentFlags().StringVar(&configFile, "config", "",
+		"TOML or YAML file of the settings keyed by the flag names, e.g. tidb-dataset.toml")
+	root.PersistentFlags().StringVar(&configProfile, "config-profile", "",
+		"Profile in the config file overriding the top-level settings, e.g. staging for [profiles.staging]")
+
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage the configuration",
+	}
+
+	var cmdShow = &cobra.Command{
+		Use:   "show",
+		Short: "Show the effective configuration with the secrets masked",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return showConfig(cmd)
+		},
+	}
+
+	cmd.AddCommand(cmdShow)
+	root.AddCommand(cmd)
+}
+
+// envName returns the environment variable of the flag.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// lookupSetting returns the value of the flag which is not set on the command
+// line, from the environment variable or the config file.
+func lookupSetting(name string, settings map[string][]string) ([]string, string, bool) {
+	if v, ok := os.LookupEnv(envName(name)); ok {
+		return []string{v}, sourceEnv, true
+	}
+	if v, ok := settings[name]; ok {
+		return v, sourceConfig, true
+	}
+	return nil, "", false
+}
+
+// applyConfig sets the flags of the command not set on the command line by
+// the environment variables and the config file, so the precedence is flag >
+// env > config > default.
+func applyConfig(cmd *cobra.Command) error {
+	settings, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	flags := cmd.Flags()
+	var setErr error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if setErr != nil {
+			return
+		}
+		if f.Changed {
+			flagSources[f.Name] = sourceFlag
+			return
+		}
+		values, source, ok := lookupSetting(f.Name, settings)
+		if !ok {
+			flagSources[f.Name] = sourceDefault
+			return
+		}
+		if err := setFlag(flags, f, values); err != nil {
+			setErr = fmt.Errorf("invalid %s of %s: %v", source, f.Name, err)
+			return
+		}
+		flagSources[f.Name] = source
+	})
+	if setErr != nil {
+		return usageErrorf("%v", setErr)
+	}
+	return nil
+}
+
+func setFlag(flags *pflag.FlagSet, f *pflag.Flag, values []string) error {
+	if sv, ok := f.Value.(pflag.SliceValue); ok && len(values) != 1 {
+		if err := sv.Replace(values); err != nil {
+			return err
+		}
+		f.Changed = true
+		return nil
+	}
+	return flags.Set(f.Name, strings.Join(values, ","))
+}
+
+// loadConfig loads the settings of the config file, the profile overrides the
+// top-level settings. The invalid config files are usage errors.
+func loadConfig(cmd *cobra.Command) (map[string][]string, error) {
+	path, profile := configFile, configProfile
+	if !cmd.Flags().Changed("config") {
+		path = os.Getenv(envName("config"))
+	}
+	if !cmd.Flags().Changed("config-profile") {
+		profile = os.Getenv(envName("config-profile"))
+	}
+	if path == "" {
+		if profile != "" {
+			return nil, usageErrorf("the config profile %s is given without the config file", profile)
+		}
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the config file: %v", err)
+	}
+	raw := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	default:
+		return nil, usageErrorf("unknown config file %s, use .toml, .yaml or .yml", path)
+	}
+	if err != nil {
+		return nil, usageErrorf("failed to parse the config file %s: %v", path, err)
+	}
+
+	profiles, ok := raw["profiles"].(map[string]interface{})
+	if !ok && raw["profiles"] != nil {
+		return nil, usageErrorf("the profiles of the config file must be tables")
+	}
+	delete(raw, "profiles")
+
+	settings, err := configSettings(cmd.Root(), raw)
+	if err != nil {
+		return nil, usageErrorf("%v", err)
+	}
+	if profile == "" {
+		return settings, nil
+	}
+
+	values, ok := profiles[profile].(map[string]interface{})
+	if !ok {
+		return nil, usageErrorf("the config profile %s is not found in %s", profile, path)
+	}
+	overrides, err := configSettings(cmd.Root(), values)
+	if err != nil {
+		return nil, usageErrorf("invalid config profile %s: %v", profile, err)
+	}
+	for name, v := range overrides {
+		settings[name] = v
+	}
+	return settings, nil
+}
+
+// configSettings converts the values of the config file into the flag values,
+// the keys must be the flags of the commands.
+func configSettings(root *cobra.Command, raw map[string]interface{}) (map[string][]string, error) {
+	known := allFlags(root)
+	settings := make(map[string][]string, len(raw))
+	for key, value := range raw {
+		name := strings.ReplaceAll(strings.ToLower(key), "_", "-")
+		if _, ok := known[name]; !ok {
+			return nil, fmt.Errorf("unknown setting %s in the config file", key)
+		}
+
+		var values []string
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				s, err := configValue(key, item)
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, s)
+			}
+		default:
+			s, err := configValue(key, v)
+			if err != nil {
+				return nil, err
+			}
+			values = []string{s}
+		}
+		settings[name] = values
+	}
+	return settings, nil
+}
+
+func configValue(key string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("the setting %s must be a string, a number, a boolean or a list of them", key)
+	}
+}
+
+// allFlags returns the first flag of each name in the commands.
+func allFlags(root *cobra.Command) map[string]*pflag.Flag {
+	flags := make(map[string]*pflag.Flag)
+	var visit func(c *cobra.Command)
+	visit = func(c *cobra.Command) {
+		add := func(f *pflag.Flag) {
+			if _, ok := flags[f.Name]; !ok {
+				flags[f.Name] = f
+			}
+		}
+		c.PersistentFlags().VisitAll(add)
+		c.Flags().VisitAll(add)
+		for _, sub := range c.Commands() {
+			visit(sub)
+		}
+	}
+	visit(root)
+	return flags
+}
+
+// dsnPassword matches the password of the DSN, which is up to the last @.
+var dsnPassword = regexp.MustCompile(`^([^:@/]*):(.+)@`)
+
+// maskSetting masks the secret of the setting.
+func maskSetting(name, value string) string {
+	switch {
+	case value == "":
+		return value
+	case secretFlags[name]:
+		return "****"
+	case dsnFlags[name]:
+		return dsnPassword.ReplaceAllString(value, "$1:****@")
+	default:
+		return value
+	}
+}
+
+// showConfig prints the settings of all the flags of the commands, the flags
+// of the config show command are set by applyConfig, and the others are
+// looked up in the same way.
+func showConfig(cmd *cobra.Command) error {
+	settings, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	flags := allFlags(cmd.Root())
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		if name != "help" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Name\tValue\tSource\tEnv")
+	for _, name := range names {
+		var value, source string
+		if f := cmd.Flags().Lookup(name); f != nil {
+			value, source = f.Value.String(), flagSources[name]
+		} else if values, src, ok := lookupSetting(name, settings); ok {
+			value, source = strings.Join(values, ","), src
+		} else {
+			value, source = flags[name].DefValue, sourceDefault
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", name, maskSetting(name, value), source, envName(name))
+	}
+	return tw.Flush()
+}
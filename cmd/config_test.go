@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestApplyConfig(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "tidb-dataset.toml")
+	config := `host = "config-host"
+port = 4001
+tables = ["books", "users"]
+
+[profiles.staging]
+host = "staging-host"
+`
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	type settings struct {
+		Host    string
+		Port    int
+		Tables  []string
+		Sources map[string]string
+	}
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want settings
+		err  bool
+	}{
+		{
+			name: "default",
+			want: settings{Host: "127.0.0.1", Port: 4000, Sources: map[string]string{
+				"host": sourceDefault, "port": sourceDefault, "tables": sourceDefault,
+			}},
+		},
+		{
+			name: "config",
+			args: []string{"--config", configPath},
+			want: settings{Host: "config-host", Port: 4001, Tables: []string{"books", "users"}, Sources: map[string]string{
+				"host": sourceConfig, "port": sourceConfig, "tables": sourceConfig,
+			}},
+		},
+		{
+			name: "config profile",
+			args: []string{"--config", configPath, "--config-profile", "staging"},
+			want: settings{Host: "staging-host", Port: 4001, Tables: []string{"books", "users"}, Sources: map[string]string{
+				"host": sourceConfig, "port": sourceConfig, "tables": sourceConfig,
+			}},
+		},
+		{
+			name: "env over config",
+			args: []string{"--config", configPath},
+			env:  map[string]string{"TIDB_DATASET_HOST": "env-host", "TIDB_DATASET_TABLES": "orders,ratings"},
+			want: settings{Host: "env-host", Port: 4001, Tables: []string{"orders", "ratings"}, Sources: map[string]string{
+				"host": sourceEnv, "port": sourceConfig, "tables": sourceEnv,
+			}},
+		},
+		{
+			name: "flag over env and config",
+			args: []string{"--config", configPath, "--host", "flag-host", "--port", "4002"},
+			env:  map[string]string{"TIDB_DATASET_HOST": "env-host", "TIDB_DATASET_PORT": "4003"},
+			want: settings{Host: "flag-host", Port: 4002, Tables: []string{"books", "users"}, Sources: map[string]string{
+				"host": sourceFlag, "port": sourceFlag, "tables": sourceConfig,
+			}},
+		},
+		{
+			name: "config from env",
+			env:  map[string]string{"TIDB_DATASET_CONFIG": configPath},
+			want: settings{Host: "config-host", Port: 4001, Tables: []string{"books", "users"}, Sources: map[string]string{
+				"host": sourceConfig, "port": sourceConfig, "tables": sourceConfig,
+			}},
+		},
+		{
+			name: "invalid env",
+			env:  map[string]string{"TIDB_DATASET_PORT": "four"},
+			err:  true,
+		},
+		{
+			name: "unknown profile",
+			args: []string{"--config", configPath, "--config-profile", "production"},
+			err:  true,
+		},
+		{
+			name: "profile without config",
+			args: []string{"--config-profile", "staging"},
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			flagSources = make(map[string]string)
+
+			var got settings
+			root := &cobra.Command{Use: "test", SilenceErrors: true, SilenceUsage: true}
+			registerConfig(root)
+			root.PersistentFlags().StringVar(&got.Host, "host", "127.0.0.1", "")
+			root.PersistentFlags().IntVar(&got.Port, "port", 4000, "")
+			sub := &cobra.Command{
+				Use:  "run",
+				RunE: func(*cobra.Command, []string) error { return nil },
+			}
+			sub.Flags().StringSliceVar(&got.Tables, "tables", nil, "")
+			root.AddCommand(sub)
+			root.PersistentPreRunE = func(cmd *cobra.Command, _ []string) error {
+				return applyConfig(cmd)
+			}
+			root.SetArgs(append([]string{"run"}, tt.args...))
+
+			err := root.Execute()
+			if tt.err {
+				if err == nil {
+					t.Fatalf("applyConfig succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyConfig failed: %v", err)
+			}
+			got.Sources = map[string]string{
+				"host": flagSources["host"], "port": flagSources["port"], "tables": flagSources["tables"],
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("applyConfig = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Mini256/tidb-dataset/pkg/db"
+	"github.com/spf13/cobra"
+)
+
+var (
+	connOpts    db.ConnOptions
+	sessionVars []string
+)
+
+func registerConnFlags(root *cobra.Command) {
+	flags := root.PersistentFlags()
+	flags.StringVarP(&connOpts.Host, "host", "H", "127.0.0.1",
+		"Database host, or comma-separated hosts with the ports balancing the connections, e.g. tidb1:4000,tidb2:4000")
+	flags.StringVar(&connOpts.Balance, "balance", db.BalanceRoundRobin,
+		fmt.Sprintf("Policy of assigning the connections to the hosts, one of %s", strings.Join(db.Balances, ", ")))
+	flags.StringVarP(&connOpts.User, "user", "U", "root", "Database user")
+	flags.StringVarP(&connOpts.Password, "password", "p", "", "Database password")
+	flags.IntVarP(&connOpts.Port, "port", "P", 4000, "Database port")
+	flags.StringVar(&connOpts.Socket, "socket", "", "Unix socket file of the database, instead of the host and port")
+	flags.StringVar(&connOpts.DSN, "dsn", "",
+		"Data source name, e.g. 'user:pass@tcp(host:4000)/bookshop?timeout=5s', instead of the host, port and user")
+
+	flags.StringVar(&connOpts.SSLMode, "ssl-mode", "",
+		fmt.Sprintf("SSL mode, one of %s (default verify-ca with --ssl-ca, required with --ssl-cert, or preferred)",
+			strings.Join(db.SSLModes, ", ")))
+	flags.StringVar(&connOpts.SSLCA, "ssl-ca", "", "Path of the CA certificate of the server")
+	flags.StringVar(&connOpts.SSLCert, "ssl-cert", "", "Path of the client certificate")
+	flags.StringVar(&connOpts.SSLKey, "ssl-key", "", "Path of the client key")
+
+	flags.DurationVar(&connOpts.ConnectTimeout, "connect-timeout", 0, "Timeout of connecting to the database")
+	flags.DurationVar(&connOpts.ReadTimeout, "read-timeout", 0, "Timeout of reading from the connections")
+	flags.DurationVar(&connOpts.WriteTimeout, "write-timeout", 0, "Timeout of writing to the connections")
+
+	flags.IntVar(&connOpts.MaxOpenConns, "max-open-conns", 0, "Maximum number of the open connections, 0 means unlimited")
+	flags.IntVar(&connOpts.MaxIdleConns, "max-idle-conns", 0, "Maximum number of the idle connections (default 2)")
+	flags.DurationVar(&connOpts.ConnMaxLifetime, "conn-max-lifetime", 0,
+		"Maximum time a connection is reused, 0 means forever")
+	flags.DurationVar(&connOpts.ConnMaxIdleTime, "conn-max-idle-time", 0,
+		"Maximum time a connection is idle before closed, 0 means forever")
+
+	flags.StringArrayVar(&sessionVars, "session-var", nil,
+		"Session variable set on every connection, e.g. --session-var tidb_mem_quota_query=8589934592, repeatable")
+}
+
+// parseConnFlags checks the connection flags.
+func parseConnFlags() error {
+	vars, err := db.ParseSessionVars(sessionVars)
+	if err != nil {
+		return usageErrorf("%v", err)
+	}
+	connOpts.SessionVars = vars
+	return nil
+}
+
+// connOptions returns the connection options of the database.
+func connOptions(dbName string) (db.ConnOptions, error) {
+	if err := resolveConnOptions(); err != nil {
+		return db.ConnOptions{}, err
+	}
+	opts := connOpts
+	opts.DBName = dbName
+	return opts, nil
+}
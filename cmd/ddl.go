@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Mini256/tidb-dataset/pkg/db"
+	"github.com/Mini256/tidb-dataset/pkg/measurement"
+	"github.com/Mini256/tidb-dataset/pkg/workload"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ddlAnnotationWindow is the window before and after a DDL compared with
+	// the operations during the DDL.
+	ddlAnnotationWindow = 30 * time.Second
+	// ddlProgressInterval is the interval of printing the progress of the
+	// running DDL jobs.
+	ddlProgressInterval = 5 * time.Second
+)
+
+// ddlRun is an executed step of the DDL script.
+type ddlRun struct {
+	step       workload.DDLStep
+	startedAt  time.Time
+	finishedAt time.Time
+	err        error
+}
+
+// runDDLScript executes the steps of the DDL script at their offsets from the
+// start of the run, the steps not reached before the context is done are
+// skipped.
+func runDDLScript(ctx context.Context, w workload.Workloader, script *workload.DDLScript,
+	startedAt time.Time) ([]ddlRun, error) {
+	log := logrus.WithField("dataset", w.Name())
+
+	// The DDL statements are executed on a dedicated connection.
+	opts, err := connOptions(w.DBName())
+	if err != nil {
+		return nil, err
+	}
+	ddlDB, err := db.OpenDB(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer db.CloseDB(ddlDB)
+
+	var runs []ddlRun
+	for _, step := range script.Steps {
+		select {
+		case <-ctx.Done():
+			return runs, nil
+		case <-time.After(time.Until(startedAt.Add(step.At))):
+		}
+
+		log.Infof("Executing DDL %s: %s", step.Name, step.SQL)
+		r := ddlRun{step: step, startedAt: time.Now()}
+
+		progressCtx, cancel := context.WithCancel(ctx)
+		progressDone := make(chan struct{})
+		go func() {
+			defer close(progressDone)
+			printDDLProgress(progressCtx, log, ddlDB, w.DBName())
+		}()
+
+		_, r.err = ddlDB.ExecContext(ctx, step.SQL)
+		r.finishedAt = time.Now()
+		cancel()
+		<-progressDone
+
+		if r.err != nil {
+			log.WithError(r.err).Errorf("DDL %s failed after %s", step.Name, r.finishedAt.Sub(r.startedAt))
+		} else {
+			log.Infof("DDL %s finished in %s.", step.Name, r.finishedAt.Sub(r.startedAt))
+		}
+		runs = append(runs, r)
+	}
+	return runs, nil
+}
+
+// printDDLProgress prints the running DDL jobs of the database periodically
+// until the context is done.
+func printDDLProgress(ctx context.Context, log *logrus.Entry, ddlDB *sql.DB, dbName string) {
+	ticker := time.NewTicker(ddlProgressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		rows, err := ddlDB.QueryContext(ctx, `
+			SELECT JOB_ID, JOB_TYPE, TABLE_NAME, SCHEMA_STATE, STATE, ROW_COUNT
+			FROM information_schema.ddl_jobs
+			WHERE DB_NAME = ? AND STATE IN ('none', 'queueing', 'running', 'rollingback')
+		`, dbName)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.WithError(err).Debug("failed to query the DDL jobs")
+			}
+			continue
+		}
+		for rows.Next() {
+			var (
+				jobID                                 int64
+				jobType, table, schemaState, jobState string
+				rowCount                              sql.NullInt64
+			)
+			if err := rows.Scan(&jobID, &jobType, &table, &schemaState, &jobState, &rowCount); err != nil {
+				log.WithError(err).Debug("failed to read the DDL jobs")
+				break
+			}
+			log.Infof("DDL job %d (%s on %s): state %s, schema state %s, %d rows processed",
+				jobID, jobType, table, jobState, schemaState, rowCount.Int64)
+		}
+		_ = rows.Close()
+	}
+}
+
+// annotateDDLs returns the annotations of the executed DDL steps.
+func annotateDDLs(timeline *measurement.Timeline, runs []ddlRun) []measurement.Annotation {
+	annotations := make([]measurement.Annotation, 0, len(runs))
+	for _, r := range runs {
+		a := timeline.Annotate(r.step.Name, r.step.SQL, r.startedAt, r.finishedAt, ddlAnnotationWindow)
+		if r.err != nil {
+			a.Error = r.err.Error()
+		}
+		annotations = append(annotations, a)
+	}
+	return annotations
+}
+
+// printAnnotations prints the throughput and the latency around each DDL.
+func printAnnotations(annotations []measurement.Annotation) error {
+	fmt.Printf("\nThroughput and latency %s before, during and %s after each DDL:\n",
+		ddlAnnotationWindow, ddlAnnotationWindow)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DDL\tSTARTED AT\tTAKES (s)\tSTATUS\tBEFORE TPS\tDURING TPS\tAFTER TPS\t"+
+		"BEFORE AVG (ms)\tDURING AVG (ms)\tAFTER AVG (ms)\tDURING MAX (ms)")
+	for _, a := range annotations {
+		status := "OK"
+		if a.Error != "" {
+			status = "FAILED"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.1f\t%s\t%.1f\t%.1f\t%.1f\t%.2f\t%.2f\t%.2f\t%.1f\n",
+			a.Name, a.StartedAt.Format(time.RFC3339), a.ElapsedS, status,
+			a.Before.TPS, a.During.TPS, a.After.TPS, a.Before.AvgMs, a.During.AvgMs, a.After.AvgMs, a.During.MaxMs)
+	}
+	return tw.Flush()
+}
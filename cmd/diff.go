@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Mini256/tidb-dataset/pkg/db"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// defaultMaxDiffRows is the default number of the different rows printed for
+// each table.
+const defaultMaxDiffRows = 100
+
+// diffConfig is the configuration of the diff command.
+type diffConfig struct {
+	upstream   string
+	downstream string
+	tables     []string
+	chunkSize  int
+	maxRows    int
+	output     string
+}
+
+var diffCfg diffConfig
+
+// registerDiff registers the diff command of the dataset, which compares the
+// tables of the dataset in two databases.
+func registerDiff(parent *cobra.Command, tables func() []string) {
+	cmd := &cobra.Command{
+		Use:   "diff --upstream <dsn> --downstream <dsn>",
+		Short: "Compare the data of the tables in the upstream and the downstream databases, e.g. a replica",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if len(diffCfg.tables) == 0 {
+				diffCfg.tables = tables()
+			}
+			return executeDiff(globalCtx)
+		},
+	}
+
+	cmd.Flags().StringVar(&diffCfg.upstream, "upstream", "",
+		"DSN of the upstream database, e.g. root:@tcp(127.0.0.1:4000)/bookshop")
+	cmd.Flags().StringVar(&diffCfg.downstream, "downstream", "",
+		"DSN of the downstream database, e.g. root:@tcp(127.0.0.1:4001)/bookshop")
+	cmd.Flags().StringSliceVar(&diffCfg.tables, "tables", nil,
+		fmt.Sprintf("Tables to compare (default %s)", strings.Join(tables(), ",")))
+	cmd.Flags().IntVar(&diffCfg.chunkSize, "chunk-size", db.DefaultChunkSize,
+		"Number of the rows in each checksum chunk")
+	cmd.Flags().IntVar(&diffCfg.maxRows, "max-rows", defaultMaxDiffRows,
+		"Maximum number of the different rows printed for each table")
+	cmd.Flags().StringVar(&diffCfg.output, "output", "",
+		"Write all the different rows into the JSON file")
+	_ = cmd.MarkFlagRequired("upstream")
+	_ = cmd.MarkFlagRequired("downstream")
+
+	parent.AddCommand(cmd)
+}
+
+func executeDiff(ctx context.Context) error {
+	upstream, err := db.OpenDSN(diffCfg.upstream)
+	if err != nil {
+		return fmt.Errorf("cannot open the upstream database: %w", err)
+	}
+	defer db.CloseDB(upstream)
+	downstream, err := db.OpenDSN(diffCfg.downstream)
+	if err != nil {
+		return fmt.Errorf("cannot open the downstream database: %w", err)
+	}
+	defer db.CloseDB(downstream)
+
+	// The tables are compared in the snapshots of the two databases, so that the
+	// chunks are consistent while the databases are being written.
+	upConn, err := db.BeginSnapshot(ctx, upstream)
+	if err != nil {
+		return fmt.Errorf("cannot start the snapshot of the upstream database: %v", err)
+	}
+	defer db.EndSnapshot(upConn)
+	downConn, err := db.BeginSnapshot(ctx, downstream)
+	if err != nil {
+		return fmt.Errorf("cannot start the snapshot of the downstream database: %v", err)
+	}
+	defer db.EndSnapshot(downConn)
+
+	var diffs []*db.TableDiff
+	for _, table := range diffCfg.tables {
+		logrus.Infof("Comparing table %s...", table)
+		d, err := db.DiffTable(ctx, upConn, downConn, table, diffCfg.chunkSize)
+		if err != nil {
+			return fmt.Errorf("failed to compare table %s: %v", table, err)
+		}
+		diffs = append(diffs, d)
+	}
+
+	if err := printDiffs(diffs); err != nil {
+		return err
+	}
+	if diffCfg.output != "" {
+		data, err := json.MarshalIndent(diffs, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(diffCfg.output, data, 0644); err != nil {
+			return err
+		}
+		logrus.Infof("Wrote the different rows into %s.", diffCfg.output)
+	}
+
+	different := 0
+	for _, d := range diffs {
+		if !d.Equal() {
+			different++
+		}
+	}
+	if different > 0 {
+		return &db.VerifyError{Reason: fmt.Sprintf("%d of %d tables are different", different, len(diffs))}
+	}
+	return nil
+}
+
+func printDiffs(diffs []*db.TableDiff) error {
+	fmt.Println()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TABLE\tUPSTREAM ROWS\tDOWNSTREAM ROWS\tCHUNKS\tMISMATCHED CHUNKS\tMISSING\tEXTRA\tDIFFERENT\tSTATUS")
+	for _, d := range diffs {
+		status := "OK"
+		if !d.Equal() {
+			status = "DIFFERENT"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n",
+			d.Table, d.UpstreamRows, d.DownstreamRows, d.Chunks, d.MismatchedChunks,
+			d.Count(db.RowMissing), d.Count(db.RowExtra), d.Count(db.RowDifferent), status)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, d := range diffs {
+		if len(d.Rows) == 0 {
+			continue
+		}
+		fmt.Printf("\n# Different rows of %s (%s)\n", d.Table, strings.Join(d.PKColumns, ", "))
+		for i, r := range d.Rows {
+			if i >= diffCfg.maxRows {
+				fmt.Printf("... %d more rows\n", len(d.Rows)-i)
+				break
+			}
+			line := fmt.Sprintf("%-9s (%s)", r.Kind, strings.Join(r.PK, ", "))
+			if len(r.Columns) > 0 {
+				line += " columns: " + strings.Join(r.Columns, ", ")
+			}
+			fmt.Println(line)
+		}
+	}
+	return nil
+}
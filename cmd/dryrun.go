@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Mini256/tidb-dataset/bookshop"
+	"github.com/Mini256/tidb-dataset/pkg/db"
+	"github.com/sirupsen/logrus"
+)
+
+// dryRunSampleRows is the number of the rows of the sample INSERT statement
+// of each table printed by the dry run.
+const dryRunSampleRows = 3
+
+// dryRunConfig is the configuration of the dry run of prepare.
+type dryRunConfig struct {
+	enabled bool
+	output  string
+}
+
+var dryRunCfg dryRunConfig
+
+// executeDryRun prints the statements of prepare with a sample of the INSERT
+// statements of each table, and the estimated rows and bytes of the tables,
+// without connecting to the database.
+func executeDryRun(ctx context.Context) error {
+	if cfg.PKStrategy.ServerAssignedID() {
+		logrus.WithField("dataset", "bookshop").Warnf("The ids are assigned by the server with the pk strategy %s, "+
+			"the child tables of the dry run refer to the ids 1..N instead of the ids assigned by the server.",
+			cfg.PKStrategy)
+	}
+	out := os.Stdout
+	if dryRunCfg.output != "" {
+		f, err := os.Create(dryRunCfg.output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	buf := bufio.NewWriter(out)
+
+	script := db.NewScriptWriter(buf, dryRunSampleRows)
+	stats, err := writeScript(ctx, script)
+	if err != nil {
+		return err
+	}
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	if dryRunCfg.output != "" {
+		if err := out.Close(); err != nil {
+			return err
+		}
+		logrus.WithField("dataset", "bookshop").Infof("Wrote the statements into %s.", dryRunCfg.output)
+	}
+
+	return printTableStats(stats, "Batches")
+}
+
+// writeScript writes the statements of prepare into the script, led by the
+// statements creating and using the database.
+func writeScript(ctx context.Context, script *db.ScriptWriter) ([]db.TableStats, error) {
+	w, err := bookshop.NewScriptWorkloader(cfg, script)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := script.WriteStatement(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", cfg.DBName)); err != nil {
+		return nil, err
+	}
+	if err := script.WriteStatement(fmt.Sprintf("USE `%s`", cfg.DBName)); err != nil {
+		return nil, err
+	}
+
+	workerCtx, err := w.InitThread(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer w.CleanupThread(workerCtx)
+	if err := w.Prepare(workerCtx); err != nil {
+		return nil, err
+	}
+	return script.Stats(), nil
+}
+
+// printTableStats prints the rows, the batches and the bytes of each table,
+// the batches are titled by the title, e.g. the row groups of parquet.
+func printTableStats(stats []db.TableStats, batchesTitle string) error {
+	fmt.Println()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Table\tRows\t%s\tBytes\n", batchesTitle)
+	var rows, batches, bytes int64
+	for _, s := range stats {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", s.Table, s.Rows, s.Batches, formatBytes(s.Bytes))
+		rows += s.Rows
+		batches += s.Batches
+		bytes += s.Bytes
+	}
+	fmt.Fprintf(tw, "Total\t%d\t%d\t%s\n", rows, batches, formatBytes(bytes))
+	return tw.Flush()
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
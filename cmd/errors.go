@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Mini256/tidb-dataset/bookshop"
+	"github.com/Mini256/tidb-dataset/pkg/db"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of the command, so that the scripts can tell the failures apart.
+const (
+	exitCodeGeneric    = 1
+	exitCodeUsage      = 2
+	exitCodeConnection = 3
+	exitCodeSchema     = 4
+	exitCodeLoad       = 5
+	exitCodeVerify     = 6
+)
+
+// usageError is a misuse of the command, e.g. a missing flag.
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *usageError) Unwrap() error {
+	return e.err
+}
+
+func usageErrorf(format string, args ...interface{}) error {
+	return &usageError{err: fmt.Errorf(format, args...)}
+}
+
+// Phases of executing the command, which tell whether an error without a type
+// is reported by cobra for a misuse of the command.
+const (
+	// phaseParse is parsing the flags and the arguments, the errors are the
+	// unknown commands or flags and the invalid arguments.
+	phaseParse = iota
+	// phasePreRun is running PersistentPreRunE.
+	phasePreRun
+	// phaseValidate is validating the required flags.
+	phaseValidate
+	// phaseRun is running the command.
+	phaseRun
+)
+
+var commandPhase = phaseParse
+
+// trackCommandStart tracks the phases of executing the commands under the
+// command.
+func trackCommandStart(cmd *cobra.Command) {
+	if preRun := cmd.PersistentPreRunE; preRun != nil {
+		cmd.PersistentPreRunE = func(c *cobra.Command, args []string) error {
+			commandPhase = phasePreRun
+			if err := preRun(c, args); err != nil {
+				return err
+			}
+			commandPhase = phaseValidate
+			return nil
+		}
+	}
+	if run := cmd.RunE; run != nil {
+		cmd.RunE = func(c *cobra.Command, args []string) error {
+			commandPhase = phaseRun
+			return run(c, args)
+		}
+	}
+	for _, sub := range cmd.Commands() {
+		trackCommandStart(sub)
+	}
+}
+
+// exitCode returns the exit code of the error of the command.
+func exitCode(err error) int {
+	var (
+		usageErr  *usageError
+		connErr   *db.ConnError
+		schemaErr *bookshop.SchemaError
+		loadErr   *db.LoadError
+		verifyErr *db.VerifyError
+	)
+	switch {
+	case errors.As(err, &usageErr) || commandPhase == phaseParse || commandPhase == phaseValidate:
+		return exitCodeUsage
+	case errors.As(err, &connErr):
+		return exitCodeConnection
+	case errors.As(err, &schemaErr):
+		return exitCodeSchema
+	case errors.As(err, &loadErr):
+		return exitCodeLoad
+	case errors.As(err, &verifyErr):
+		return exitCodeVerify
+	default:
+		return exitCodeGeneric
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Mini256/tidb-dataset/bookshop"
+	"github.com/Mini256/tidb-dataset/pkg/db"
+)
+
+func TestExitCode(t *testing.T) {
+	errIO := errors.New("open tidb-dataset.toml: permission denied")
+
+	tests := []struct {
+		name  string
+		phase int
+		err   error
+		want  int
+	}{
+		{name: "unknown flag", phase: phaseParse, err: errors.New("unknown flag: --bogus"), want: exitCodeUsage},
+		{name: "usage error in pre-run", phase: phasePreRun, err: usageErrorf("unknown log format"), want: exitCodeUsage},
+		{name: "io error in pre-run", phase: phasePreRun, err: errIO, want: exitCodeGeneric},
+		{name: "required flag", phase: phaseValidate, err: errors.New(`required flag(s) "upstream" not set`),
+			want: exitCodeUsage},
+		{name: "usage error", phase: phaseRun, err: fmt.Errorf("failed: %w", usageErrorf("--output is required")),
+			want: exitCodeUsage},
+		{name: "connection", phase: phaseRun, err: fmt.Errorf("failed: %w", &db.ConnError{Err: errIO}),
+			want: exitCodeConnection},
+		{name: "schema", phase: phaseRun, err: &bookshop.SchemaError{Err: errIO}, want: exitCodeSchema},
+		{name: "load", phase: phaseRun, err: fmt.Errorf("failed: %w", &db.LoadError{Table: "books", Err: errIO}),
+			want: exitCodeLoad},
+		{name: "verify", phase: phaseRun, err: &db.VerifyError{Reason: "1 of 6 tables are different"},
+			want: exitCodeVerify},
+		{name: "generic", phase: phaseRun, err: errIO, want: exitCodeGeneric},
+	}
+
+	defer func() { commandPhase = phaseParse }()
+	for _, tt := range tests {
+		commandPhase = tt.phase
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("%s: exitCode(%v) = %d, want %d", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
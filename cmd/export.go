@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Mini256/tidb-dataset/pkg/db"
+	"github.com/klauspost/compress/zstd"
+	"github.com/sirupsen/logrus"
+)
+
+// Formats of the data written by prepare instead of loading it into the
+// database.
+const (
+	formatSQL     = "sql"
+	formatParquet = "parquet"
+)
+
+// exportBufferSize is the size of the buffer of the output file.
+const exportBufferSize = 1 << 20
+
+// exportConfig is the configuration of writing the data into a file.
+type exportConfig struct {
+	format string
+	output string
+}
+
+var exportCfg exportConfig
+
+// executeExport writes the data of prepare into the output file in the
+// format, without connecting to the database.
+func executeExport(ctx context.Context) error {
+	if exportCfg.output == "" {
+		return usageErrorf("--output is required by --format")
+	}
+	if cfg.PKStrategy.ServerAssignedID() {
+		// The child tables refer to the ids, which are only known after the
+		// rows are inserted into the database.
+		return usageErrorf("--format cannot be used with --pk-strategy %s, whose ids are assigned by the server",
+			cfg.PKStrategy)
+	}
+	log := logrus.WithField("dataset", "bookshop")
+
+	switch exportCfg.format {
+	case formatSQL:
+		stats, err := exportSQL(ctx, exportCfg.output)
+		if err != nil {
+			_ = os.Remove(exportCfg.output)
+			return err
+		}
+		log.Infof("Wrote the sql dump into %s.", exportCfg.output)
+		return printTableStats(stats, "Batches")
+	case formatParquet:
+		stats, err := exportParquet(ctx, exportCfg.output)
+		if err != nil {
+			return err
+		}
+		log.Infof("Wrote the parquet files into %s.", exportCfg.output)
+		return printTableStats(stats, "Row groups")
+	default:
+		return usageErrorf("unknown format %s, use %s or %s", exportCfg.format, formatSQL, formatParquet)
+	}
+}
+
+// exportSQL writes the SQL dump into the file, the statements are streamed
+// into the file batch by batch.
+func exportSQL(ctx context.Context, path string) ([]db.TableStats, error) {
+	out, err := createOutput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+	buf := bufio.NewWriterSize(out, exportBufferSize)
+
+	script := db.NewScriptWriter(buf, 0)
+	if err := script.WriteComment("Bookshop dataset generated by tidb-dataset at %s",
+		time.Now().Format(time.RFC3339)); err != nil {
+		return nil, err
+	}
+	stats, err := writeScript(ctx, script)
+	if err != nil {
+		return nil, err
+	}
+	if err := buf.Flush(); err != nil {
+		return nil, err
+	}
+	return stats, out.Close()
+}
+
+// compressedFile is the file written through the compressor.
+type compressedFile struct {
+	io.WriteCloser
+	file   *os.File
+	closed bool
+}
+
+// Close closes the compressor and then the file, it can be called again.
+func (f *compressedFile) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	if err := f.WriteCloser.Close(); err != nil {
+		_ = f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
+
+// createOutput creates the output file, which is compressed by gzip or zstd if
+// the file ends with .gz or .zst.
+func createOutput(path string) (io.WriteCloser, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz":
+		return &compressedFile{WriteCloser: gzip.NewWriter(f), file: f}, nil
+	case ".zst":
+		zw, err := zstd.NewWriter(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		return &compressedFile{WriteCloser: zw, file: f}, nil
+	default:
+		return f, nil
+	}
+}
@@ -3,21 +3,23 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/Mini256/tidb-dataset/pkg/metrics"
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 var (
-	host     string
-	port     int
-	user     string
-	password string
-	driver   string
+	driver string
+
+	metricsAddr string
+	logFormat   string
 
 	globalCtx context.Context
 )
@@ -26,19 +28,59 @@ func main() {
 	var rootCmd = &cobra.Command{
 		Use:   os.Args[0],
 		Short: "The example dataset import tool for the demo of TiDB.",
+		// The errors are logged with the exit codes in main.
+		SilenceErrors: true,
+		SilenceUsage:  true,
 	}
 
-	rootCmd.PersistentFlags().StringVarP(&host, "host", "H", "127.0.0.1", "Database host")
-	rootCmd.PersistentFlags().StringVarP(&user, "user", "U", "root", "Database user")
-	rootCmd.PersistentFlags().StringVarP(&password, "password", "p", "", "Database password")
-	rootCmd.PersistentFlags().IntVarP(&port, "port", "P", 4000, "Database port")
+	registerConnFlags(rootCmd)
+	registerPasswordFlags(rootCmd)
 	rootCmd.PersistentFlags().StringVarP(&driver, "driver", "d", "", "Database driver: mysql")
+	rootCmd.PersistentFlags().StringVar(&metricsAddr, "metrics-addr", "",
+		"Expose the Prometheus metrics on the address, e.g. :9099")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "Log format: text, json")
+
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, _ []string) error {
+		if err := applyConfig(cmd); err != nil {
+			return err
+		}
+
+		switch logFormat {
+		case "text":
+		case "json":
+			logrus.SetFormatter(&logrus.JSONFormatter{})
+		default:
+			return usageErrorf("unknown log format %s, use text or json", logFormat)
+		}
+		if err := parseConnFlags(); err != nil {
+			return err
+		}
+
+		if metricsAddr == "" {
+			return nil
+		}
+		go func() {
+			if err := metrics.Serve(metricsAddr); err != nil {
+				logrus.WithError(err).Errorf("failed to serve the metrics on %s", metricsAddr)
+			}
+		}()
+		return nil
+	}
 
 	cobra.EnablePrefixMatching = true
 
 	// Register the dataset modules.
 	registerBookshop(rootCmd)
 
+	registerCompare(rootCmd)
+
+	registerConfig(rootCmd)
+
+	rejectArgs(rootCmd)
+	trackCommandStart(rootCmd)
+
+	metrics.Handle("/control/rate", http.HandlerFunc(handleRunRate))
+
 	var cancel context.CancelFunc
 	globalCtx, cancel = context.WithCancel(context.Background())
 
@@ -64,13 +106,17 @@ func main() {
 		}
 	}()
 
+	rootCmd.SetArgs(attachPasswordArgs(os.Args[1:]))
 	err := rootCmd.Execute()
-	if err != nil {
-		return
-	}
 	cancel()
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		code := exitCode(err)
+		log := logrus.WithError(err).WithField("exit_code", code)
+		if code == exitCodeUsage {
+			log.Errorf("invalid usage, run '%s --help' for the usage", os.Args[0])
+		} else {
+			log.Error("failed to execute the command")
+		}
+		os.Exit(code)
 	}
 }
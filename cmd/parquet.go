@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mini256/tidb-dataset/bookshop"
+	"github.com/Mini256/tidb-dataset/pkg/db"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// parquetCompressions are the supported compressions of the parquet files.
+var parquetCompressions = map[string]parquet.CompressionCodec{
+	"none":   parquet.CompressionCodec_UNCOMPRESSED,
+	"snappy": parquet.CompressionCodec_SNAPPY,
+	"gzip":   parquet.CompressionCodec_GZIP,
+	"zstd":   parquet.CompressionCodec_ZSTD,
+	"lz4":    parquet.CompressionCodec_LZ4,
+}
+
+// defaultRowGroupSize is the default size of the row groups in MiB.
+const defaultRowGroupSize = 128
+
+// parquetConfig is the configuration of the parquet files.
+type parquetConfig struct {
+	compression string
+	// rowGroupSize is the size of the row groups in MiB.
+	rowGroupSize int64
+}
+
+var parquetCfg parquetConfig
+
+func parquetCompressionNames() string {
+	names := make([]string, 0, len(parquetCompressions))
+	for name := range parquetCompressions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// exportParquet writes the rows of each table into the parquet file named
+// {db}.{table}.parquet in the directory, which is the naming of the data
+// files recognized by TiDB Lightning.
+func exportParquet(ctx context.Context, dir string) ([]db.TableStats, error) {
+	compression, ok := parquetCompressions[strings.ToLower(parquetCfg.compression)]
+	if !ok {
+		return nil, usageErrorf("unknown parquet compression %s, use one of %s",
+			parquetCfg.compression, parquetCompressionNames())
+	}
+	if parquetCfg.rowGroupSize <= 0 {
+		return nil, usageErrorf("the parquet row group size must be positive")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	sink := &parquetSink{
+		dir:          dir,
+		dbName:       cfg.DBName,
+		compression:  compression,
+		rowGroupSize: parquetCfg.rowGroupSize * 1024 * 1024,
+	}
+	w, err := bookshop.NewExportWorkloader(cfg, sink)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Export(ctx); err != nil {
+		sink.remove()
+		return nil, err
+	}
+	return sink.stats, nil
+}
+
+// parquetSink writes the rows of the tables into the parquet files.
+type parquetSink struct {
+	dir          string
+	dbName       string
+	compression  parquet.CompressionCodec
+	rowGroupSize int64
+
+	files   []string
+	writers []*parquetRowWriter
+	stats   []db.TableStats
+}
+
+// OpenTable implements bookshop.RowSink.
+func (s *parquetSink) OpenTable(table string, columns []bookshop.Column) (bookshop.RowWriter, error) {
+	fields := make([]string, 0, len(columns))
+	for _, c := range columns {
+		field, err := parquetField(c)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+
+	path := filepath.Join(s.dir, fmt.Sprintf("%s.%s.parquet", s.dbName, table))
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	s.files = append(s.files, path)
+
+	buf := bufio.NewWriterSize(f, exportBufferSize)
+	pw, err := writer.NewCSVWriterFromWriter(fields, buf, 1)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	pw.CompressionType = s.compression
+	pw.RowGroupSize = s.rowGroupSize
+
+	w := &parquetRowWriter{
+		sink:    s,
+		table:   table,
+		columns: columns,
+		file:    f,
+		buf:     buf,
+		writer:  pw,
+	}
+	s.writers = append(s.writers, w)
+	return w, nil
+}
+
+// remove closes the files still being written and removes the written files.
+func (s *parquetSink) remove() {
+	for _, w := range s.writers {
+		if !w.closed {
+			w.closed = true
+			_ = w.file.Close()
+		}
+	}
+	for _, path := range s.files {
+		_ = os.Remove(path)
+	}
+}
+
+// parquetField returns the schema of the column in the metadata of the CSV
+// writer of parquet-go.
+func parquetField(c bookshop.Column) (string, error) {
+	var field string
+	switch c.Type {
+	case bookshop.TypeBigInt:
+		field = "type=INT64"
+	case bookshop.TypeInt:
+		field = "type=INT32"
+	case bookshop.TypeSmallInt:
+		field = "type=INT32, convertedtype=INT_16"
+	case bookshop.TypeTinyInt:
+		field = "type=INT32, convertedtype=INT_8"
+	case bookshop.TypeDecimal:
+		field = fmt.Sprintf("type=INT64, convertedtype=DECIMAL, precision=%d, scale=%d", c.Precision, c.Scale)
+	case bookshop.TypeVarchar, bookshop.TypeEnum:
+		field = "type=BYTE_ARRAY, convertedtype=UTF8"
+	case bookshop.TypeDateTime:
+		field = "type=INT64, convertedtype=TIMESTAMP_MICROS"
+	default:
+		return "", fmt.Errorf("unsupported type %s of the column %s", c.Type, c.Name)
+	}
+
+	repetition := "REQUIRED"
+	if c.Nullable {
+		repetition = "OPTIONAL"
+	}
+	return fmt.Sprintf("name=%s, %s, repetitiontype=%s", c.Name, field, repetition), nil
+}
+
+// parquetRowWriter writes the rows of a table into the parquet file.
+type parquetRowWriter struct {
+	sink    *parquetSink
+	table   string
+	columns []bookshop.Column
+	rows    int64
+
+	// closed tells whether the file is closed.
+	closed bool
+	file   *os.File
+	buf    *bufio.Writer
+	writer *writer.CSVWriter
+}
+
+func (w *parquetRowWriter) WriteRow(_ context.Context, row []interface{}) error {
+	// The writer keeps the records until the row group is written.
+	rec := make([]interface{}, len(row))
+	for i, v := range row {
+		pv, err := parquetValue(w.columns[i], v)
+		if err != nil {
+			return err
+		}
+		rec[i] = pv
+	}
+	w.rows++
+	return w.writer.Write(rec)
+}
+
+func (w *parquetRowWriter) Close(_ context.Context) error {
+	w.closed = true
+	if err := w.writer.WriteStop(); err != nil {
+		_ = w.file.Close()
+		return err
+	}
+	if err := w.buf.Flush(); err != nil {
+		_ = w.file.Close()
+		return err
+	}
+	info, err := w.file.Stat()
+	if err != nil {
+		_ = w.file.Close()
+		return err
+	}
+	w.sink.stats = append(w.sink.stats, db.TableStats{
+		Table:   w.table,
+		Rows:    w.rows,
+		Bytes:   info.Size(),
+		Batches: int64(len(w.writer.Footer.RowGroups)),
+	})
+	return w.file.Close()
+}
+
+// parquetValue converts the value of the column into the value of the parquet
+// type, the same as the value stored by the database.
+func parquetValue(c bookshop.Column, v interface{}) (interface{}, error) {
+	if v == nil {
+		if !c.Nullable {
+			return nil, fmt.Errorf("null value of the column %s", c.Name)
+		}
+		return nil, nil
+	}
+
+	switch v := v.(type) {
+	case int64:
+		return v, nil
+	case int:
+		if c.Type == bookshop.TypeBigInt {
+			return int64(v), nil
+		}
+		return int32(v), nil
+	case float64:
+		return unscaledDecimal(v, c.Scale)
+	case string:
+		return v, nil
+	case time.Time:
+		// The datetime columns have no fractional seconds.
+		return v.Unix() * int64(time.Second/time.Microsecond), nil
+	default:
+		return nil, fmt.Errorf("unsupported value %v of the column %s", v, c.Name)
+	}
+}
+
+// unscaledDecimal returns the unscaled value of the decimal of the scale,
+// which is rounded half away from zero from the value in the form of %f, the
+// same as the value inserted into the database.
+func unscaledDecimal(v float64, scale int) (int64, error) {
+	s := strconv.FormatFloat(v, 'f', 6, 64)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	parts := strings.SplitN(s, ".", 2)
+	frac := parts[1] + strings.Repeat("0", scale+1)
+	n, err := strconv.ParseInt(parts[0]+frac[:scale], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if frac[scale] >= '5' {
+		n++
+	}
+	if negative {
+		n = -n
+	}
+	return n, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestUnscaledDecimal(t *testing.T) {
+	tests := []struct {
+		value float64
+		scale int
+		want  int64
+	}{
+		{value: 0, scale: 2, want: 0},
+		{value: 12.34, scale: 2, want: 1234},
+		{value: 12.345, scale: 2, want: 1235},
+		{value: 12.344999, scale: 2, want: 1234},
+		{value: 9999.999999, scale: 2, want: 1000000},
+		{value: 0.005, scale: 2, want: 1},
+		{value: -12.34, scale: 2, want: -1234},
+		{value: -12.345, scale: 2, want: -1235},
+		{value: -0.001, scale: 2, want: 0},
+		{value: 2.4, scale: 0, want: 2},
+		{value: 2.5, scale: 0, want: 3},
+		{value: -2.5, scale: 0, want: -3},
+		{value: 1.5, scale: 8, want: 150000000},
+		{value: 3454.734982, scale: 2, want: 345473},
+	}
+
+	for _, tt := range tests {
+		got, err := unscaledDecimal(tt.value, tt.scale)
+		if err != nil {
+			t.Errorf("unscaledDecimal(%f, %d) failed: %v", tt.value, tt.scale, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("unscaledDecimal(%f, %d) = %d, want %d", tt.value, tt.scale, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Mini256/tidb-dataset/pkg/db"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// askPassword is the value of --password given without a value, which asks
+// for the password.
+const askPassword = "\x00ask"
+
+// mysqlPwdEnv is the environment variable of the password of the mysql client.
+const mysqlPwdEnv = "MYSQL_PWD"
+
+var (
+	askPass      bool
+	passwordFile string
+	defaultsFile string
+
+	resolveOnce sync.Once
+	resolveErr  error
+)
+
+func registerPasswordFlags(root *cobra.Command) {
+	root.PersistentFlags().Lookup("password").NoOptDefVal = askPassword
+	root.PersistentFlags().BoolVar(&askPass, "ask-pass", false,
+		"Ask for the password without echo, the same as --password without a value")
+	root.PersistentFlags().StringVar(&passwordFile, "password-file", "",
+		"Read the password from the first line of the file")
+	root.PersistentFlags().StringVar(&defaultsFile, "defaults-file", "",
+		"MySQL option file whose [client] group gives the connection options not set otherwise (default ~/.my.cnf)")
+}
+
+// resolveConnOptions completes the connection options not set by the flags,
+// the environment variables or the config file, from the prompt, the password
+// file, the MySQL option file and MYSQL_PWD in order. It is done once and only
+// for the commands connecting to the database.
+func resolveConnOptions() error {
+	resolveOnce.Do(func() {
+		resolveErr = resolvePassword()
+	})
+	return resolveErr
+}
+
+func resolvePassword() error {
+	optionFilePassword, err := applyOptionFile()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case askPass || connOpts.Password == askPassword:
+		password, err := promptPassword()
+		if err != nil {
+			return err
+		}
+		connOpts.Password = password
+	case flagSources["password"] != sourceDefault &&
+		sourceRank(flagSources["password"]) >= sourceRank(flagSources["password-file"]):
+	case passwordFile != "":
+		data, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return fmt.Errorf("failed to read the password file: %v", err)
+		}
+		connOpts.Password = strings.TrimRight(strings.SplitN(string(data), "\n", 2)[0], "\r")
+	case optionFilePassword != nil:
+		connOpts.Password = *optionFilePassword
+	default:
+		if password, ok := os.LookupEnv(mysqlPwdEnv); ok {
+			connOpts.Password = password
+		}
+	}
+	return nil
+}
+
+// rejectArgs rejects the arguments of the commands under the command which
+// take none. Like the mysql client, the value of -p must be attached to it,
+// so the value of "-p secret" is an argument, which must not be ignored while
+// asking for the password.
+func rejectArgs(cmd *cobra.Command) {
+	if cmd.Runnable() && cmd.Args == nil {
+		cmd.Args = cobra.NoArgs
+	}
+	for _, sub := range cmd.Commands() {
+		rejectArgs(sub)
+	}
+}
+
+// attachPasswordArgs rewrites -pVALUE into -p=VALUE, since pflag parses the
+// letters after a shorthand with NoOptDefVal as more shorthands.
+func attachPasswordArgs(args []string) []string {
+	result := make([]string, 0, len(args))
+	for i, arg := range args {
+		if arg == "--" {
+			return append(result, args[i:]...)
+		}
+		if strings.HasPrefix(arg, "-p") && len(arg) > 2 && arg[2] != '=' {
+			arg = "-p=" + arg[2:]
+		}
+		result = append(result, arg)
+	}
+	return result
+}
+
+func promptPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", usageErrorf("cannot ask for the password, the standard input is not a terminal")
+	}
+	fmt.Fprint(os.Stderr, "Enter password: ")
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the password: %v", err)
+	}
+	return string(password), nil
+}
+
+// applyOptionFile sets the connection options not set otherwise by the
+// [client] group of the MySQL option file, and returns the password in it,
+// which takes precedence over MYSQL_PWD.
+func applyOptionFile() (*string, error) {
+	path := defaultsFile
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		path = filepath.Join(home, ".my.cnf")
+	}
+
+	options, err := db.ReadOptionFile(path, "client")
+	if err != nil {
+		if defaultsFile == "" && errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read the option file %s: %v", path, err)
+	}
+
+	var password *string
+
+	isDefault := func(name string) bool {
+		return flagSources[name] == sourceDefault
+	}
+	for name, value := range options {
+		if !isDefault(name) {
+			continue
+		}
+		switch name {
+		case "password":
+			value := value
+			password = &value
+		case "user":
+			connOpts.User = value
+		case "host":
+			connOpts.Host = value
+		case "port":
+			port, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, usageErrorf("invalid port %s in the option file %s", value, path)
+			}
+			connOpts.Port = port
+		case "socket":
+			connOpts.Socket = value
+		case "ssl-mode":
+			connOpts.SSLMode = strings.ReplaceAll(strings.ToLower(value), "_", "-")
+		case "ssl-ca":
+			connOpts.SSLCA = value
+		case "ssl-cert":
+			connOpts.SSLCert = value
+		case "ssl-key":
+			connOpts.SSLKey = value
+		}
+	}
+	return password, nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAttachPasswordArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{args: []string{"bookshop", "prepare", "-psecret"}, want: []string{"bookshop", "prepare", "-p=secret"}},
+		{args: []string{"bookshop", "prepare", "-p=secret"}, want: []string{"bookshop", "prepare", "-p=secret"}},
+		{args: []string{"bookshop", "prepare", "-p"}, want: []string{"bookshop", "prepare", "-p"}},
+		{args: []string{"bookshop", "prepare", "--password"}, want: []string{"bookshop", "prepare", "--password"}},
+		{args: []string{"-P", "4001", "-pp@ss"}, want: []string{"-P", "4001", "-p=p@ss"}},
+		{args: []string{"query", "run", "--", "-pname"}, want: []string{"query", "run", "--", "-pname"}},
+		{args: []string{}, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := attachPasswordArgs(tt.args); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("attachPasswordArgs(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
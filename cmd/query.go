@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Mini256/tidb-dataset/pkg/query"
+	"github.com/Mini256/tidb-dataset/pkg/workload"
+	"github.com/spf13/cobra"
+)
+
+// queryConfig is the configuration of the query commands.
+type queryConfig struct {
+	names      []string
+	all        bool
+	explainDir string
+	reportFile string
+}
+
+var queryCfg queryConfig
+
+// registerQuery registers the query commands of the dataset, the execute
+// function executes the action of the dataset.
+func registerQuery(parent *cobra.Command, queries func() []workload.Query, execute func(action string) error) {
+	cmd := &cobra.Command{
+		Use:   "query",
+		Short: "Run the built-in queries of the dataset",
+	}
+
+	var cmdList = &cobra.Command{
+		Use:   "list",
+		Short: "List the built-in queries",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return listQueries(queries())
+		},
+	}
+
+	var cmdRun = &cobra.Command{
+		Use:   "run <name>...|--all",
+		Short: "Run the built-in queries and print the results",
+		Args:  cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && !queryCfg.all {
+				return usageErrorf("please specify the query names or --all")
+			}
+			queryCfg.names = args
+			return execute("query-run")
+		},
+	}
+
+	cmdRun.Flags().BoolVar(&queryCfg.all, "all", false, "Run all the built-in queries")
+	cmdRun.Flags().StringVar(&queryCfg.explainDir, "explain-dir", "",
+		"Save the EXPLAIN ANALYZE output of each query into the directory")
+	cmdRun.Flags().StringVar(&queryCfg.reportFile, "report", "",
+		"Save the plans, plan digests and latencies of the queries into the JSON report file")
+
+	cmd.AddCommand(cmdList)
+	cmd.AddCommand(cmdRun)
+
+	parent.AddCommand(cmd)
+}
+
+func listQueries(queries []workload.Query) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tDESCRIPTION")
+	for _, q := range queries {
+		fmt.Fprintf(tw, "%s\t%s\n", q.Name, q.Description)
+	}
+	return tw.Flush()
+}
+
+// selectQueries returns the queries chosen by the query config.
+func selectQueries(queries []workload.Query) ([]workload.Query, error) {
+	if queryCfg.all {
+		return queries, nil
+	}
+
+	selected := make([]workload.Query, 0, len(queryCfg.names))
+	for _, name := range queryCfg.names {
+		found := false
+		for _, q := range queries {
+			if q.Name == name {
+				selected = append(selected, q)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown query %s, use the query list command to show the queries", name)
+		}
+	}
+	return selected, nil
+}
+
+// runQueries runs the chosen queries, prints the results and timing, and
+// saves the EXPLAIN ANALYZE output and the report if required.
+func runQueries(ctx context.Context, globalDB *sql.DB, dataset string, queries []workload.Query) error {
+	queries, err := selectQueries(queries)
+	if err != nil {
+		return err
+	}
+
+	if queryCfg.explainDir != "" {
+		if err := os.MkdirAll(queryCfg.explainDir, 0755); err != nil {
+			return err
+		}
+	}
+
+	conn, err := globalDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	report := &query.Report{Dataset: dataset, CreatedAt: time.Now()}
+	if err := conn.QueryRowContext(ctx, "SELECT VERSION()").Scan(&report.ServerVersion); err != nil {
+		return err
+	}
+
+	timing := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(timing, "QUERY\tROWS\tELAPSED")
+	for _, q := range queries {
+		fmt.Printf("\n# %s: %s\n", q.Name, q.Description)
+		result, err := query.Run(ctx, conn, q.SQL)
+		if err != nil {
+			return fmt.Errorf("failed to run query %s: %v", q.Name, err)
+		}
+		if err := result.Print(os.Stdout); err != nil {
+			return err
+		}
+		fmt.Printf("(%d rows in %s)\n", len(result.Rows), result.Elapsed.Round(time.Millisecond))
+		fmt.Fprintf(timing, "%s\t%d\t%s\n", q.Name, len(result.Rows), result.Elapsed.Round(time.Millisecond))
+
+		if queryCfg.explainDir == "" && queryCfg.reportFile == "" {
+			continue
+		}
+		// The plan digest is only known to TiDB, the other databases are
+		// compared by the plan shapes.
+		var planDigest string
+		if strings.Contains(report.ServerVersion, "TiDB") {
+			if planDigest, err = query.PlanDigest(ctx, conn, q.SQL); err != nil {
+				return fmt.Errorf("failed to get the plan digest of query %s: %v", q.Name, err)
+			}
+		}
+		plan, err := query.ExplainAnalyze(ctx, conn, q.SQL)
+		if err != nil {
+			return fmt.Errorf("failed to explain query %s: %v", q.Name, err)
+		}
+		if queryCfg.explainDir != "" {
+			if err := savePlan(q.Name, plan); err != nil {
+				return err
+			}
+		}
+		report.Queries = append(report.Queries, query.NewQueryReport(q.Name, q.SQL, result, planDigest, plan))
+	}
+
+	fmt.Println()
+	if err := timing.Flush(); err != nil {
+		return err
+	}
+
+	if queryCfg.reportFile != "" {
+		fmt.Printf("\nSaving the report into %s.\n", queryCfg.reportFile)
+		return report.WriteFile(queryCfg.reportFile)
+	}
+	return nil
+}
+
+// savePlan saves the EXPLAIN ANALYZE output of the query into the directory.
+func savePlan(name string, plan *query.Result) error {
+	f, err := os.Create(filepath.Join(queryCfg.explainDir, name+".txt"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := plan.Print(f); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Mini256/tidb-dataset/pkg/db"
+	"github.com/Mini256/tidb-dataset/pkg/measurement"
+	"github.com/Mini256/tidb-dataset/pkg/workload"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/time/rate"
+)
+
+// runConfig is the configuration of the run commands.
+type runConfig struct {
+	threads        int
+	duration       time.Duration
+	warmup         time.Duration
+	rate           float64
+	reportInterval time.Duration
+	outputReport   string
+	ddlScript      string
+}
+
+var runCfg runConfig
+
+// runLimiter is the token bucket shared by the threads of the current run,
+// which limits the transactions per second.
+var runLimiter = rate.NewLimiter(rate.Inf, 1)
+
+// registerRunFlags registers the flags of the run command.
+func registerRunFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().IntVarP(&runCfg.threads, "threads", "T", 8, "Number of threads")
+	cmd.PersistentFlags().DurationVar(&runCfg.duration, "duration", 0,
+		"Execution time of the run after the warmup, 0 means running until interrupted")
+	cmd.PersistentFlags().DurationVar(&runCfg.warmup, "warmup", 0,
+		"Warmup time before the run, the transactions in the warmup are excluded from the summary")
+	cmd.PersistentFlags().Float64Var(&runCfg.rate, "rate", 0,
+		"Target transactions per second shared by all threads, 0 means unlimited, "+
+			"it can be changed while running by PUT /control/rate?value=<tps> on --metrics-addr")
+	cmd.PersistentFlags().DurationVar(&runCfg.reportInterval, "interval", 10*time.Second,
+		"Interval of printing the measurement")
+	cmd.PersistentFlags().StringVar(&runCfg.outputReport, "output-report", "",
+		"Write the summary into the report file, as CSV if the file ends with .csv, or as JSON otherwise")
+	cmd.PersistentFlags().StringVar(&runCfg.ddlScript, "ddl-script", "",
+		"YAML file of the DDL statements executed at the given offsets into the run")
+}
+
+// executeRun runs the workload with the threads until the time is up or the
+// context is canceled, and then prints the summary.
+func executeRun(ctx context.Context, w workload.Workloader) error {
+	report, err := runWorkload(ctx, w)
+	if err != nil {
+		return err
+	}
+	return writeRunReport(report)
+}
+
+// warmupEnder is implemented by the workloads with their own statistics of
+// the run, which are reset at the end of the warmup like the measurement.
+type warmupEnder interface {
+	EndWarmup()
+}
+
+// runWorkload runs the workload once and returns the summary of the run.
+func runWorkload(ctx context.Context, w workload.Workloader) (*measurement.Report, error) {
+	log := logrus.WithField("dataset", w.Name())
+
+	var script *workload.DDLScript
+	if runCfg.ddlScript != "" {
+		var err error
+		if script, err = workload.LoadDDLScript(runCfg.ddlScript); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.InitRun(ctx); err != nil {
+		return nil, err
+	}
+
+	if runCfg.duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, runCfg.warmup+runCfg.duration)
+		defer cancel()
+	}
+
+	setRunRate(runCfg.rate)
+
+	m := w.Measurement()
+	m.Reset()
+	startedAt := time.Now()
+	hostsBefore := db.HostStats()
+
+	var warmupDone <-chan time.Time
+	if runCfg.warmup > 0 {
+		log.Infof("Warming up for %s...", runCfg.warmup)
+		warmupDone = time.After(runCfg.warmup)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < runCfg.threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			threadCtx, err := w.InitThread(ctx)
+			if err != nil {
+				log.WithError(err).Error("failed to init the thread")
+				return
+			}
+			defer w.CleanupThread(threadCtx)
+
+			for ctx.Err() == nil {
+				if err := runLimiter.Wait(ctx); err != nil {
+					return
+				}
+				// The failed transactions are counted by the measurement.
+				if err := w.Run(threadCtx); err != nil && ctx.Err() == nil {
+					log.WithError(err).Debug("failed to execute the transaction")
+				}
+			}
+		}()
+	}
+
+	var (
+		ddlRuns []ddlRun
+		ddlErr  error
+		ddlDone = make(chan struct{})
+	)
+	if script != nil {
+		runStartedAt := time.Now()
+		go func() {
+			defer close(ddlDone)
+			ddlRuns, ddlErr = runDDLScript(ctx, w, script, runStartedAt)
+		}()
+	} else {
+		close(ddlDone)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(runCfg.reportInterval)
+	defer ticker.Stop()
+
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			m.Output(false)
+		case <-warmupDone:
+			log.Info("Warmup finished, start measuring...")
+			// The timeline keeps the warmup, which the offsets of the DDL
+			// script are counted from.
+			m.ResetSummary()
+			if r, ok := w.(warmupEnder); ok {
+				r.EndWarmup()
+			}
+			startedAt = time.Now()
+			hostsBefore = db.HostStats()
+		case <-done:
+			break loop
+		}
+	}
+
+	m.Output(true)
+
+	report := &measurement.Report{
+		Dataset:    w.Name(),
+		StartedAt:  startedAt,
+		Threads:    runCfg.threads,
+		ElapsedS:   time.Since(startedAt).Seconds(),
+		Operations: m.Summary(),
+	}
+	report.Hosts = hostThroughput(hostsBefore, db.HostStats(), report.ElapsedS)
+	if err := printHosts(report.Hosts); err != nil {
+		return nil, err
+	}
+
+	<-ddlDone
+	if ddlErr != nil {
+		return nil, fmt.Errorf("failed to execute the DDL script: %v", ddlErr)
+	}
+	if len(ddlRuns) > 0 {
+		report.Annotations = annotateDDLs(m.Timeline(), ddlRuns)
+		if err := printAnnotations(report.Annotations); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// hostThroughput returns the throughput of each host between the two
+// snapshots of the host statistics.
+func hostThroughput(before, after []db.HostStat, elapsedS float64) []measurement.HostStats {
+	// Only the balanced connections to multiple hosts are counted.
+	if len(after) < 2 {
+		return nil
+	}
+	started := make(map[string]db.HostStat, len(before))
+	for _, s := range before {
+		started[s.Addr] = s
+	}
+
+	hosts := make([]measurement.HostStats, 0, len(after))
+	for _, s := range after {
+		h := measurement.HostStats{
+			Host:       s.Addr,
+			Statements: s.Statements - started[s.Addr].Statements,
+			Errors:     s.Errors - started[s.Addr].Errors,
+			Downs:      s.Downs - started[s.Addr].Downs,
+		}
+		if elapsedS > 0 {
+			h.QPS = float64(h.Statements) / elapsedS
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts
+}
+
+// printHosts prints the throughput of each host.
+func printHosts(hosts []measurement.HostStats) error {
+	if len(hosts) == 0 {
+		return nil
+	}
+	fmt.Println()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Host\tStatements\tQPS\tErrors\tDowns")
+	for _, h := range hosts {
+		fmt.Fprintf(tw, "%s\t%d\t%.1f\t%d\t%d\n", h.Host, h.Statements, h.QPS, h.Errors, h.Downs)
+	}
+	return tw.Flush()
+}
+
+// writeRunReport writes the report into the file given by --output-report.
+func writeRunReport(report *measurement.Report) error {
+	if runCfg.outputReport == "" {
+		return nil
+	}
+	if err := report.WriteFile(runCfg.outputReport); err != nil {
+		return err
+	}
+	logrus.WithField("dataset", report.Dataset).Infof("Wrote the report into %s.", runCfg.outputReport)
+	return nil
+}
+
+// profileNames returns the names of the built-in profiles.
+func profileNames(profiles []workload.Profile) string {
+	names := make([]string, 0, len(profiles))
+	for _, p := range profiles {
+		names = append(names, p.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// setRunRate sets the target transactions per second of the run, the rate
+// less than or equal to 0 means unlimited.
+func setRunRate(tps float64) {
+	if tps <= 0 {
+		runLimiter.SetLimit(rate.Inf)
+		return
+	}
+	runLimiter.SetLimit(rate.Limit(tps))
+}
+
+// handleRunRate shows the target rate of the run, or changes it by the value
+// parameter, e.g. "curl -X PUT localhost:9099/control/rate?value=800".
+func handleRunRate(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		tps, err := strconv.ParseFloat(r.URL.Query().Get("value"), 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid rate: %v", err), http.StatusBadRequest)
+			return
+		}
+		setRunRate(tps)
+		logrus.Infof("The target rate of the run is changed to %.1f TPS.", tps)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := runLimiter.Limit()
+	if limit == rate.Inf {
+		fmt.Fprintln(w, "unlimited")
+		return
+	}
+	fmt.Fprintf(w, "%.1f\n", float64(limit))
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Mini256/tidb-dataset/bookshop"
+	"github.com/Mini256/tidb-dataset/pkg/db"
+	"github.com/Mini256/tidb-dataset/pkg/measurement"
+	"github.com/sirupsen/logrus"
+)
+
+// modeRun is the result of the hot-book scenario in a transaction mode.
+type modeRun struct {
+	mode       string
+	report     *measurement.Report
+	contention bookshop.ContentionStats
+}
+
+// executeHotBook runs the hot-book scenario in each transaction mode one by
+// one, and compares the conflicts and the throughput of the modes.
+func executeHotBook(ctx context.Context, w *bookshop.Workloader) error {
+	log := logrus.WithField("dataset", w.Name())
+
+	if runCfg.duration <= 0 {
+		return usageErrorf("the %s scenario runs in each transaction mode, please specify --duration",
+			bookshop.ScenarioHotBook)
+	}
+
+	var runs []modeRun
+	for _, mode := range bookshop.TxnModes {
+		log.Infof("Running the %s scenario in the %s mode for %s...", bookshop.ScenarioHotBook, mode, runCfg.duration)
+		w.SetTxnMode(mode)
+		report, err := runWorkload(ctx, w)
+		if err != nil {
+			return fmt.Errorf("failed to run in the %s mode: %w", mode, err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		runs = append(runs, modeRun{mode: mode, report: report, contention: w.Contention()})
+	}
+
+	if err := printModeRuns(runs); err != nil {
+		return err
+	}
+
+	// Merge the summaries of the modes into one report, the operations are
+	// prefixed by the mode.
+	report := *runs[0].report
+	report.Operations = nil
+	for _, r := range runs {
+		for _, op := range r.report.Operations {
+			op.Operation = r.mode + "/" + op.Operation
+			report.Operations = append(report.Operations, op)
+		}
+	}
+	return writeRunReport(&report)
+}
+
+func printModeRuns(runs []modeRun) error {
+	fmt.Println()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODE\tTPS\tCOMMITTED\tFAILED\tCONFLICTS\tRETRIES\tLOCK WAITS\tAVG LOCK WAIT (ms)\t"+
+		"LOCK WAIT TIMEOUTS\tP99 (ms)")
+	for _, r := range runs {
+		var committed, failed int64
+		var tps, p99 float64
+		for _, op := range r.report.Operations {
+			committed += op.Count
+			failed += op.Errors
+			tps += op.TPS
+			if op.P99Ms > p99 {
+				p99 = op.P99Ms
+			}
+		}
+		c := r.contention
+		fmt.Fprintf(tw, "%s\t%.1f\t%d\t%d\t%d\t%d\t%d\t%.2f\t%d\t%.1f\n",
+			r.mode, tps, committed, failed, c.Conflicts, c.Retries, c.LockWaits,
+			float64(c.AvgLockWait().Microseconds())/1000, c.LockWaitTimeouts, p99)
+	}
+	return tw.Flush()
+}
+
+// executeBank runs the bank scenario with a verifier checking the total
+// balance of the users concurrently, and reports the violations.
+func executeBank(ctx context.Context, w *bookshop.Workloader) error {
+	verifyCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var check *bookshop.BalanceCheck
+	verified := make(chan struct{})
+	go func() {
+		defer close(verified)
+		check = w.VerifyBalances(verifyCtx)
+	}()
+
+	report, err := runWorkload(ctx, w)
+	cancel()
+	<-verified
+	if err != nil {
+		return err
+	}
+
+	c := w.Contention()
+	fmt.Printf("\nConflicts: %d, Retries: %d, Lock wait timeouts: %d\n",
+		c.Conflicts, c.Retries, c.LockWaitTimeouts)
+	fmt.Printf("Balance checks: %d, Failed checks: %d, Violations: %d, Expected total: %s\n",
+		check.Checks, check.Failures, len(check.Violations), check.Expected)
+	if len(check.Violations) > 0 {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "CHECKED AT\tSNAPSHOT TS\tEXPECTED\tACTUAL")
+		for _, v := range check.Violations {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", v.CheckedAt.Format(time.RFC3339Nano), v.SnapshotTS, v.Expected, v.Actual)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if err := writeRunReport(report); err != nil {
+		return err
+	}
+	if len(check.Violations) > 0 {
+		return &db.VerifyError{
+			Reason: fmt.Sprintf("the total balance changed in %d of %d checks", len(check.Violations), check.Checks),
+		}
+	}
+	return nil
+}
+
+// readModeRun is the result of the run in a read mode.
+type readModeRun struct {
+	mode      bookshop.ReadMode
+	report    *measurement.Report
+	freshness *bookshop.Freshness
+}
+
+// executeReadModes runs the workload in each read mode one by one, with the
+// freshness of the reads probed concurrently, and compares the modes.
+func executeReadModes(ctx context.Context, w *bookshop.Workloader, modes []string) error {
+	log := logrus.WithField("dataset", w.Name())
+
+	var readModes []bookshop.ReadMode
+	for _, s := range modes {
+		m, err := bookshop.ParseReadMode(s)
+		if err != nil {
+			return usageErrorf("%v", err)
+		}
+		readModes = append(readModes, m)
+	}
+	if len(readModes) > 1 && runCfg.duration <= 0 {
+		return usageErrorf("the run compares %d read modes one by one, please specify --duration", len(readModes))
+	}
+
+	var runs []readModeRun
+	for _, m := range readModes {
+		log.Infof("Running in the %s read mode...", m)
+		w.SetReadMode(m)
+
+		probeCtx, cancel := context.WithCancel(ctx)
+		var (
+			freshness *bookshop.Freshness
+			probeErr  error
+		)
+		probed := make(chan struct{})
+		go func() {
+			defer close(probed)
+			freshness, probeErr = w.ProbeFreshness(probeCtx, bookshop.DefaultFreshnessInterval)
+		}()
+
+		report, err := runWorkload(ctx, w)
+		cancel()
+		<-probed
+		if err != nil {
+			return fmt.Errorf("failed to run in the %s read mode: %w", m, err)
+		}
+		if probeErr != nil {
+			return fmt.Errorf("failed to probe the freshness in the %s read mode: %w", m, probeErr)
+		}
+		// The interrupted run is still reported if it's the last mode.
+		if ctx.Err() != nil && len(runs)+1 < len(readModes) {
+			return ctx.Err()
+		}
+		runs = append(runs, readModeRun{mode: m, report: report, freshness: freshness})
+	}
+
+	if err := printReadModeRuns(runs); err != nil {
+		return err
+	}
+
+	report := *runs[0].report
+	report.Operations = nil
+	for _, r := range runs {
+		for _, op := range r.report.Operations {
+			op.Operation = r.mode.String() + "/" + op.Operation
+			report.Operations = append(report.Operations, op)
+		}
+	}
+	return writeRunReport(&report)
+}
+
+func printReadModeRuns(runs []readModeRun) error {
+	isRead := make(map[string]bool)
+	for _, name := range bookshop.ReadTxns() {
+		isRead[name] = true
+	}
+
+	fmt.Println()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "READ MODE\tREAD TPS\tREAD ERRORS\tAVG (ms)\tP99 (ms)\tPROBES\tSTALE PROBES\t"+
+		"AVG MISSED ORDERS\tMAX MISSED ORDERS")
+	for _, r := range runs {
+		var (
+			count, failed int64
+			tps, total    float64
+			p99           float64
+		)
+		for _, op := range r.report.Operations {
+			if !isRead[op.Operation] {
+				continue
+			}
+			count += op.Count
+			failed += op.Errors
+			tps += op.TPS
+			total += op.AvgMs * float64(op.Count)
+			if op.P99Ms > p99 {
+				p99 = op.P99Ms
+			}
+		}
+		avg := 0.0
+		if count > 0 {
+			avg = total / float64(count)
+		}
+		f := r.freshness
+		fmt.Fprintf(tw, "%s\t%.1f\t%d\t%.2f\t%.1f\t%d\t%d\t%.1f\t%d\n",
+			r.mode, tps, failed, avg, p99, f.Probes, f.Stale, f.AvgMissed(), f.MaxMissed)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/Mini256/tidb-dataset/bookshop"
+	"github.com/Mini256/tidb-dataset/pkg/util"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// streamConfig is the configuration of the stream command.
+type streamConfig struct {
+	inserts        util.Rate
+	updates        util.Rate
+	deletes        util.Rate
+	threads        int
+	duration       time.Duration
+	reportInterval time.Duration
+	changeLog      string
+}
+
+var streamCfg streamConfig
+
+// registerStreamFlags registers the flags of the stream command.
+func registerStreamFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().Var(&streamCfg.inserts, "inserts", "Rate of the inserts, e.g. 100/s, 0 means no insert")
+	cmd.PersistentFlags().Var(&streamCfg.updates, "updates", "Rate of the updates, e.g. 50/s, 0 means no update")
+	cmd.PersistentFlags().Var(&streamCfg.deletes, "deletes", "Rate of the deletes, e.g. 5/s, 0 means no delete")
+	cmd.PersistentFlags().IntVarP(&streamCfg.threads, "threads", "T", bookshop.DefaultStreamThreads,
+		"Number of threads of each kind of the mutations")
+	cmd.PersistentFlags().DurationVar(&streamCfg.duration, "duration", 0,
+		"Execution time of the stream, 0 means running until interrupted")
+	cmd.PersistentFlags().DurationVar(&streamCfg.reportInterval, "interval", 10*time.Second,
+		"Interval of printing the measurement")
+	cmd.PersistentFlags().StringVar(&streamCfg.changeLog, "change-log", "",
+		"Write every change into the file as JSON lines in the order of the commit ts, with the primary keys "+
+			"and the after-images, which needs TiDB")
+}
+
+// executeStream keeps mutating the tables until the time is up or the context
+// is canceled, and then prints the summary.
+func executeStream(ctx context.Context, w *bookshop.Workloader) error {
+	log := logrus.WithField("dataset", w.Name())
+
+	sc := bookshop.StreamConfig{
+		Inserts:   float64(streamCfg.inserts),
+		Updates:   float64(streamCfg.updates),
+		Deletes:   float64(streamCfg.deletes),
+		Threads:   streamCfg.threads,
+		ChangeLog: streamCfg.changeLog,
+	}
+	if sc.Inserts <= 0 && sc.Updates <= 0 && sc.Deletes <= 0 {
+		log.Warn("No mutation is streamed, please specify --inserts, --updates or --deletes.")
+		return nil
+	}
+
+	if streamCfg.duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, streamCfg.duration)
+		defer cancel()
+	}
+
+	var streamErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		streamErr = w.Stream(ctx, sc)
+	}()
+
+	m := w.Measurement()
+	ticker := time.NewTicker(streamCfg.reportInterval)
+	defer ticker.Stop()
+
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			m.Output(false)
+		case <-done:
+			break loop
+		}
+	}
+	// The summary is printed even if writing the change log failed.
+	m.Output(true)
+	return streamErr
+}
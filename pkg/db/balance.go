@@ -0,0 +1,348 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Policies of assigning the connections to the hosts.
+const (
+	BalanceRoundRobin = "round-robin"
+	BalanceLeastConns = "least-conns"
+)
+
+// Balances are the supported policies of assigning the connections.
+var Balances = []string{BalanceRoundRobin, BalanceLeastConns}
+
+// hostDownPeriod is how long an unhealthy host is skipped before it is tried
+// again.
+const hostDownPeriod = 10 * time.Second
+
+// HostStat is the statistics of the connections to a host.
+type HostStat struct {
+	Addr string
+	// Conns is the number of the open connections.
+	Conns int64
+	// Statements is the number of the executed statements, and Errors is the
+	// number of the failed ones.
+	Statements int64
+	Errors     int64
+	// Downs is the number of the times the host is marked down.
+	Downs int64
+	Down  bool
+}
+
+// hostCounter counts the statements of a host, it is shared by the databases
+// connecting to the same host.
+type hostCounter struct {
+	conns      int64
+	statements int64
+	errors     int64
+	downs      int64
+
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+var hostCounters sync.Map
+
+func counterOf(addr string) *hostCounter {
+	c, _ := hostCounters.LoadOrStore(addr, &hostCounter{})
+	return c.(*hostCounter)
+}
+
+// HostStats returns the statistics of the hosts of the load balanced
+// databases, sorted by the address.
+func HostStats() []HostStat {
+	var stats []HostStat
+	now := time.Now()
+	hostCounters.Range(func(key, value interface{}) bool {
+		c := value.(*hostCounter)
+		stats = append(stats, HostStat{
+			Addr:       key.(string),
+			Conns:      atomic.LoadInt64(&c.conns),
+			Statements: atomic.LoadInt64(&c.statements),
+			Errors:     atomic.LoadInt64(&c.errors),
+			Downs:      atomic.LoadInt64(&c.downs),
+			Down:       c.isDown(now),
+		})
+		return true
+	})
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Addr < stats[j].Addr
+	})
+	return stats
+}
+
+func (c *hostCounter) isDown(now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return now.Before(c.downUntil)
+}
+
+func (c *hostCounter) markDown() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if now.After(c.downUntil) {
+		atomic.AddInt64(&c.downs, 1)
+	}
+	c.downUntil = now.Add(hostDownPeriod)
+}
+
+func (c *hostCounter) observe(err error) {
+	if err == driver.ErrSkip {
+		return
+	}
+	atomic.AddInt64(&c.statements, 1)
+	if err != nil {
+		atomic.AddInt64(&c.errors, 1)
+		if errors.Is(err, driver.ErrBadConn) {
+			c.markDown()
+		}
+	}
+}
+
+// splitHosts returns the addresses of the comma-separated hosts, the port is
+// used for the hosts without ports.
+func splitHosts(hosts string, port int) []string {
+	var addrs []string
+	for _, h := range strings.Split(hosts, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(h); err != nil {
+			h = net.JoinHostPort(h, strconv.Itoa(port))
+		}
+		addrs = append(addrs, h)
+	}
+	return addrs
+}
+
+// balancedConnector assigns the new connections to the hosts by the policy,
+// the hosts failed to connect are skipped for a while.
+type balancedConnector struct {
+	policy string
+	addrs  []string
+	hosts  []driver.Connector
+	next   uint64
+}
+
+func newBalancedConnector(cfg *mysql.Config, addrs []string, policy string) (*balancedConnector, error) {
+	c := &balancedConnector{policy: policy, addrs: addrs}
+	for _, addr := range addrs {
+		hostCfg := cfg.Clone()
+		hostCfg.Addr = addr
+		connector, err := mysql.NewConnector(hostCfg)
+		if err != nil {
+			return nil, err
+		}
+		c.hosts = append(c.hosts, connector)
+	}
+	return c, nil
+}
+
+// Connect implements driver.Connector.
+func (c *balancedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	var lastErr error
+	for _, i := range c.candidates() {
+		counter := counterOf(c.addrs[i])
+		conn, err := c.hosts[i].Connect(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			counter.markDown()
+			lastErr = err
+			continue
+		}
+		atomic.AddInt64(&counter.conns, 1)
+		return &hostConn{Conn: conn, counter: counter}, nil
+	}
+	return nil, lastErr
+}
+
+// Driver implements driver.Connector.
+func (c *balancedConnector) Driver() driver.Driver {
+	return c.hosts[0].Driver()
+}
+
+// candidates returns the hosts in the order of trying, the hosts marked down
+// are tried at last, in case all of them are down.
+func (c *balancedConnector) candidates() []int {
+	start := int(atomic.AddUint64(&c.next, 1)-1) % len(c.hosts)
+	now := time.Now()
+
+	var up, down []int
+	for k := 0; k < len(c.hosts); k++ {
+		i := (start + k) % len(c.hosts)
+		if counterOf(c.addrs[i]).isDown(now) {
+			down = append(down, i)
+		} else {
+			up = append(up, i)
+		}
+	}
+
+	if c.policy == BalanceLeastConns {
+		sort.SliceStable(up, func(a, b int) bool {
+			return atomic.LoadInt64(&counterOf(c.addrs[up[a]]).conns) <
+				atomic.LoadInt64(&counterOf(c.addrs[up[b]]).conns)
+		})
+	}
+	return append(up, down...)
+}
+
+// hostConn counts the statements executed on the connection of a host.
+type hostConn struct {
+	driver.Conn
+	counter *hostCounter
+}
+
+func (c *hostConn) Close() error {
+	atomic.AddInt64(&c.counter.conns, -1)
+	return c.Conn.Close()
+}
+
+func (c *hostConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := c.Conn.Prepare(query)
+	if err != nil {
+		c.counter.observe(err)
+		return nil, err
+	}
+	return &hostStmt{Stmt: stmt, counter: c.counter}, nil
+}
+
+func (c *hostConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	preparer, ok := c.Conn.(driver.ConnPrepareContext)
+	if !ok {
+		return c.Prepare(query)
+	}
+	stmt, err := preparer.PrepareContext(ctx, query)
+	if err != nil {
+		c.counter.observe(err)
+		return nil, err
+	}
+	return &hostStmt{Stmt: stmt, counter: c.counter}, nil
+}
+
+func (c *hostConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin() //nolint:staticcheck
+}
+
+func (c *hostConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	result, err := execer.ExecContext(ctx, query, args)
+	c.counter.observe(err)
+	return result, err
+}
+
+func (c *hostConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	rows, err := queryer.QueryContext(ctx, query, args)
+	c.counter.observe(err)
+	return rows, err
+}
+
+func (c *hostConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *hostConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *hostConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *hostConn) CheckNamedValue(v *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
+
+// hostStmt counts the executions of the prepared statement.
+type hostStmt struct {
+	driver.Stmt
+	counter *hostCounter
+}
+
+func (s *hostStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	var (
+		result driver.Result
+		err    error
+	)
+	if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+		result, err = execer.ExecContext(ctx, args)
+	} else {
+		result, err = s.Stmt.Exec(namedValues(args)) //nolint:staticcheck
+	}
+	s.counter.observe(err)
+	return result, err
+}
+
+func (s *hostStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	var (
+		rows driver.Rows
+		err  error
+	)
+	if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = queryer.QueryContext(ctx, args)
+	} else {
+		rows, err = s.Stmt.Query(namedValues(args)) //nolint:staticcheck
+	}
+	s.counter.observe(err)
+	return rows, err
+}
+
+func (s *hostStmt) ColumnConverter(idx int) driver.ValueConverter {
+	if converter, ok := s.Stmt.(driver.ColumnConverter); ok { //nolint:staticcheck
+		return converter.ColumnConverter(idx)
+	}
+	return driver.DefaultParameterConverter
+}
+
+func (s *hostStmt) CheckNamedValue(v *driver.NamedValue) error {
+	if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
+
+func namedValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
@@ -0,0 +1,27 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitHosts(t *testing.T) {
+	tests := []struct {
+		hosts string
+		port  int
+		want  []string
+	}{
+		{hosts: "127.0.0.1", port: 4000, want: []string{"127.0.0.1:4000"}},
+		{hosts: "tidb-0,tidb-1:4001", port: 4000, want: []string{"tidb-0:4000", "tidb-1:4001"}},
+		{hosts: " tidb-0 , , tidb-1 ,", port: 4000, want: []string{"tidb-0:4000", "tidb-1:4000"}},
+		{hosts: "::1", port: 4000, want: []string{"[::1]:4000"}},
+		{hosts: "[::1]:4001,fe80::1", port: 4000, want: []string{"[::1]:4001", "[fe80::1]:4000"}},
+		{hosts: "", port: 4000, want: nil},
+	}
+
+	for _, tt := range tests {
+		if got := splitHosts(tt.hosts, tt.port); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitHosts(%q, %d) = %q, want %q", tt.hosts, tt.port, got, tt.want)
+		}
+	}
+}
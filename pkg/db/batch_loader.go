@@ -1,12 +1,13 @@
 package db
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
-	"fmt"
 	"strings"
 	"time"
+
+	"github.com/Mini256/tidb-dataset/pkg/metrics"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -18,42 +19,50 @@ type BatchLoader interface {
 	Flush(ctx context.Context) error
 }
 
+// BatchWriter writes a batch of the row values into the table, e.g. executes
+// the INSERT statement or writes it into a script.
+type BatchWriter interface {
+	WriteBatch(ctx context.Context, table, insertHint string, values []string) error
+}
+
+// InsertStatement returns the multi-row INSERT statement of the values.
+func InsertStatement(insertHint string, values []string) string {
+	return insertHint + " " + strings.Join(values, ", ")
+}
+
 // SQLBatchLoader helps us insert in batch
 type SQLBatchLoader struct {
+	table      string
 	insertHint string
-	db         *sql.DB
-	buf        bytes.Buffer
-	count      int
-
-	// loader retry
-	retryCount    int
-	retryInterval time.Duration
+	writer     BatchWriter
+	values     []string
+	batchSize  int
 }
 
 // NewSQLBatchLoader creates a batch loader for database connection
-func NewSQLBatchLoader(db *sql.DB, hint string, retryCount int, retryInterval time.Duration) *SQLBatchLoader {
+func NewSQLBatchLoader(db *sql.DB, table, hint string, retryCount int, retryInterval time.Duration) *SQLBatchLoader {
+	return NewBatchLoader(NewExecBatchWriter(db, retryCount, retryInterval), table, hint, maxBatchCount)
+}
+
+// NewBatchLoader creates a batch loader writing the batches of the batch size
+// by the writer, the default batch size is used if it is not positive.
+func NewBatchLoader(writer BatchWriter, table, hint string, batchSize int) *SQLBatchLoader {
+	if batchSize <= 0 {
+		batchSize = maxBatchCount
+	}
 	return &SQLBatchLoader{
-		count:         0,
-		insertHint:    hint,
-		db:            db,
-		retryCount:    retryCount,
-		retryInterval: retryInterval,
+		table:      table,
+		insertHint: hint,
+		writer:     writer,
+		batchSize:  batchSize,
 	}
 }
 
 // InsertValue inserts a value, the loader may flush all pending values.
 func (b *SQLBatchLoader) InsertValue(ctx context.Context, query []string) error {
-	sep := ", "
-	if b.count == 0 {
-		b.buf.WriteString(b.insertHint)
-		sep = " "
-	}
-	b.buf.WriteString(sep)
-	b.buf.WriteString(query[0])
-
-	b.count++
+	b.values = append(b.values, query[0])
 
-	if b.count >= maxBatchCount {
+	if len(b.values) >= b.batchSize {
 		return b.Flush(ctx)
 	}
 
@@ -62,29 +71,65 @@ func (b *SQLBatchLoader) InsertValue(ctx context.Context, query []string) error
 
 // Flush inserts all pending values
 func (b *SQLBatchLoader) Flush(ctx context.Context) error {
-	if b.buf.Len() == 0 {
+	if len(b.values) == 0 {
 		return nil
 	}
 
+	err := b.writer.WriteBatch(ctx, b.table, b.insertHint, b.values)
+	b.values = b.values[:0]
+	return err
+}
+
+// ExecBatchWriter executes the INSERT statements of the batches on the
+// database, the failed statements are retried.
+type ExecBatchWriter struct {
+	db *sql.DB
+
+	// loader retry
+	retryCount    int
+	retryInterval time.Duration
+}
+
+// NewExecBatchWriter creates a batch writer for database connection.
+func NewExecBatchWriter(db *sql.DB, retryCount int, retryInterval time.Duration) *ExecBatchWriter {
+	return &ExecBatchWriter{
+		db:            db,
+		retryCount:    retryCount,
+		retryInterval: retryInterval,
+	}
+}
+
+// WriteBatch implements BatchWriter.
+func (e *ExecBatchWriter) WriteBatch(ctx context.Context, table, insertHint string, values []string) error {
+	query := InsertStatement(insertHint, values)
+
 	var err error
-	for i := 0; i < 1+b.retryCount; i++ {
-		_, err = b.db.ExecContext(ctx, b.buf.String())
+	start := time.Now()
+	for i := 0; i < 1+e.retryCount; i++ {
+		_, err = e.db.ExecContext(ctx, query)
 		if err == nil {
 			break
 		}
+		metrics.ObserveError(err)
 		if strings.Contains(err.Error(), "Error 1062: Duplicate entry") {
 			if i == 0 {
-				return fmt.Errorf("exec statement error: %v", err)
+				break
 			}
+			// The previous try may have been committed.
+			err = nil
 			break
 		}
-		if i < b.retryCount {
-			fmt.Printf("exec statement error: %v, may try again later...\n", err)
-			time.Sleep(b.retryInterval)
+		if i < e.retryCount {
+			logrus.WithError(err).WithField("table", table).Warnf("failed to insert the batch, retry in %s",
+				e.retryInterval)
+			metrics.ObserveRetry(err)
+			time.Sleep(e.retryInterval)
 		}
 	}
-	b.count = 0
-	b.buf.Reset()
+	metrics.ObserveFlush(table, len(values), time.Since(start), err)
 
+	if err != nil {
+		return &LoadError{Table: table, Err: err}
+	}
 	return nil
 }
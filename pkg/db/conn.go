@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+
+	"github.com/go-sql-driver/mysql"
 )
 
 const (
@@ -19,15 +21,17 @@ func CloseDB(globalDB *sql.DB) {
 	globalDB = nil
 }
 
-func OpenDB(dbName, host string, port int, user, password string) (*sql.DB, error) {
-	var (
-		err error
-		dsn = fmt.Sprintf("%s:%s@tcp(%s:%d)/", user, password, host, port)
-	)
+// OpenDB opens the database of the options, the database is created if it
+// does not exist.
+func OpenDB(opts ConnOptions) (*sql.DB, error) {
+	cfg, err := opts.mysqlConfig()
+	if err != nil {
+		return nil, &ConnError{Err: err}
+	}
 
-	globalDB, err := sql.Open(mysqlDriver, fmt.Sprintf("%s%s?tls=preferred", dsn, dbName))
+	globalDB, err := openBalanced(cfg, opts)
 	if err != nil {
-		return nil, err
+		return nil, &ConnError{Err: err}
 	}
 
 	// Check if it can connect to the database.
@@ -36,25 +40,67 @@ func OpenDB(dbName, host string, port int, user, password string) (*sql.DB, erro
 
 		// If the specified database does not exist, create one.
 		if strings.Contains(errString, unknownDB) {
-			var tmpDB *sql.DB
-			tmpDB, openErr := sql.Open(mysqlDriver, fmt.Sprintf("%s?tls=preferred", dsn))
+			tmpCfg := cfg.Clone()
+			tmpCfg.DBName = ""
+			tmpDB, openErr := openConfig(tmpCfg)
 			if openErr != nil {
-				return nil, openErr
+				return nil, &ConnError{Err: openErr}
 			}
 			defer func(db *sql.DB) {
-				err := db.Close()
-				if err != nil {
-					panic(err)
-				}
+				_ = db.Close()
 			}(tmpDB)
-			if _, execErr := tmpDB.Exec(createDBDDL + dbName); execErr != nil {
-				return nil, fmt.Errorf("failed to create database, err %v", execErr)
+			if _, execErr := tmpDB.Exec(createDBDDL + cfg.DBName); execErr != nil {
+				return nil, &ConnError{Err: fmt.Errorf("failed to create database, err %v", execErr)}
 			}
 		} else {
-			globalDB = nil
-			return nil, err
+			_ = globalDB.Close()
+			return nil, &ConnError{Err: err}
 		}
 	}
 
+	opts.setPool(globalDB)
 	return globalDB, nil
 }
+
+// openBalanced opens the database balancing the connections to the hosts.
+func openBalanced(cfg *mysql.Config, opts ConnOptions) (*sql.DB, error) {
+	addrs := opts.addrs()
+	if opts.DSN != "" || opts.Socket != "" || len(addrs) == 1 {
+		return openConfig(cfg)
+	}
+
+	policy := opts.Balance
+	if policy == "" {
+		policy = BalanceRoundRobin
+	}
+	if policy != BalanceRoundRobin && policy != BalanceLeastConns {
+		return nil, fmt.Errorf("unknown balance policy %s, use one of %s", policy, strings.Join(Balances, ", "))
+	}
+	connector, err := newBalancedConnector(cfg, addrs, policy)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(connector), nil
+}
+
+func openConfig(cfg *mysql.Config) (*sql.DB, error) {
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(connector), nil
+}
+
+// OpenDSN opens the database of the DSN, e.g.
+// "root:@tcp(127.0.0.1:4000)/bookshop", and checks the connection.
+func OpenDSN(dsn string) (*sql.DB, error) {
+	db, err := sql.Open(mysqlDriver, dsn)
+	if err != nil {
+		return nil, &ConnError{Err: err}
+	}
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, &ConnError{Err: err}
+	}
+	return db, nil
+}
@@ -0,0 +1,436 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultChunkSize is the default number of the rows in a checksum chunk.
+const DefaultChunkSize = 1000
+
+// Kinds of the different rows.
+const (
+	// RowMissing is a row of the upstream missing in the downstream.
+	RowMissing = "missing"
+	// RowExtra is a row of the downstream not in the upstream.
+	RowExtra = "extra"
+	// RowDifferent is a row whose columns differ in the two databases.
+	RowDifferent = "different"
+)
+
+// nullValue is the string of the NULL values in the row images.
+const nullValue = "NULL"
+
+// RowDiff is a row different in the upstream and the downstream.
+type RowDiff struct {
+	Kind string   `json:"kind"`
+	PK   []string `json:"pk"`
+	// Columns are the names of the different columns of the different row.
+	Columns []string `json:"columns,omitempty"`
+}
+
+// TableDiff is the result of comparing a table in the two databases.
+type TableDiff struct {
+	Table            string    `json:"table"`
+	PKColumns        []string  `json:"pk_columns"`
+	Chunks           int       `json:"chunks"`
+	MismatchedChunks int       `json:"mismatched_chunks"`
+	UpstreamRows     int64     `json:"upstream_rows"`
+	DownstreamRows   int64     `json:"downstream_rows"`
+	Rows             []RowDiff `json:"rows,omitempty"`
+}
+
+// Count returns the number of the different rows of the kind.
+func (d *TableDiff) Count(kind string) int {
+	n := 0
+	for _, r := range d.Rows {
+		if r.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// Equal tells whether the table is the same in the two databases.
+func (d *TableDiff) Equal() bool {
+	return d.MismatchedChunks == 0 && len(d.Rows) == 0
+}
+
+// BeginSnapshot returns a connection of the database in a transaction with a
+// consistent snapshot, so that all the chunks of the tables compared on it are
+// read at the same point, even if the database is being written.
+func BeginSnapshot(ctx context.Context, db *sql.DB) (*sql.Conn, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, "START TRANSACTION WITH CONSISTENT SNAPSHOT"); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// EndSnapshot ends the transaction of the snapshot and closes the connection.
+func EndSnapshot(conn *sql.Conn) {
+	_, _ = conn.ExecContext(context.Background(), "ROLLBACK")
+	_ = conn.Close()
+}
+
+// pkKind is the kind of the values of a primary key column, the bounds of the
+// chunks are bound as the values of the kind, so that the big integers are
+// not compared as floats.
+type pkKind int
+
+const (
+	pkString pkKind = iota
+	pkInt
+	pkUint
+)
+
+// tableDiffer compares a table chunk by chunk in the order of the primary key,
+// the rows of the chunks with different checksums are compared one by one.
+type tableDiffer struct {
+	upstream   *sql.Conn
+	downstream *sql.Conn
+	table      string
+	columns    []string
+	pkColumns  []string
+	pkKinds    []pkKind
+	chunkSize  int
+}
+
+// DiffTable compares the table in the upstream and the downstream databases,
+// the connections are usually the ones of BeginSnapshot.
+func DiffTable(ctx context.Context, upstream, downstream *sql.Conn, table string, chunkSize int) (*TableDiff, error) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	d := &tableDiffer{upstream: upstream, downstream: downstream, table: table, chunkSize: chunkSize}
+
+	var err error
+	if d.columns, err = queryStrings(ctx, upstream, `
+		SELECT COLUMN_NAME FROM information_schema.columns
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION
+	`, table); err != nil {
+		return nil, err
+	}
+	if len(d.columns) == 0 {
+		return nil, fmt.Errorf("table %s is not found in the upstream", table)
+	}
+	if d.pkColumns, err = queryStrings(ctx, upstream, `
+		SELECT COLUMN_NAME FROM information_schema.key_column_usage
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND CONSTRAINT_NAME = 'PRIMARY'
+		ORDER BY ORDINAL_POSITION
+	`, table); err != nil {
+		return nil, err
+	}
+	if len(d.pkColumns) == 0 {
+		return nil, fmt.Errorf("table %s has no primary key", table)
+	}
+	for _, c := range d.pkColumns {
+		kind, err := d.pkKind(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		d.pkKinds = append(d.pkKinds, kind)
+	}
+
+	return d.diff(ctx)
+}
+
+func (d *tableDiffer) diff(ctx context.Context) (*TableDiff, error) {
+	result := &TableDiff{Table: d.table, PKColumns: d.pkColumns}
+
+	// The chunks are (lower, upper] ranges of the primary key in the upstream,
+	// the first chunk has no lower bound so that the extra rows of the
+	// downstream before the upstream are covered. After the upstream, the
+	// extra rows of the downstream are chunked in the downstream, so that no
+	// chunk is unbounded.
+	source := d.upstream
+	var lower []interface{}
+	for {
+		upper, err := d.chunkUpper(ctx, source, lower)
+		if err != nil {
+			return nil, err
+		}
+		if upper == nil {
+			if source == d.upstream {
+				source = d.downstream
+				continue
+			}
+			return result, nil
+		}
+		result.Chunks++
+
+		where, args := d.rangeCondition(lower, upper)
+		upCount, upSum, err := d.checksum(ctx, d.upstream, where, args)
+		if err != nil {
+			return nil, fmt.Errorf("failed to checksum %s in the upstream: %v", d.table, err)
+		}
+		downCount, downSum, err := d.checksum(ctx, d.downstream, where, args)
+		if err != nil {
+			return nil, fmt.Errorf("failed to checksum %s in the downstream: %v", d.table, err)
+		}
+		result.UpstreamRows += upCount
+		result.DownstreamRows += downCount
+
+		if upCount != downCount || upSum != downSum {
+			result.MismatchedChunks++
+			rows, err := d.diffRows(ctx, where, args)
+			if err != nil {
+				return nil, err
+			}
+			result.Rows = append(result.Rows, rows...)
+		}
+		lower = upper
+	}
+}
+
+// chunkUpper returns the primary key of the last row of the chunk after the
+// lower bound in the database, which is the last row of the table if fewer
+// rows than a chunk are left, or nil if no row is left.
+func (d *tableDiffer) chunkUpper(ctx context.Context, conn *sql.Conn, lower []interface{}) ([]interface{}, error) {
+	where, args := d.rangeCondition(lower, nil)
+	upper, err := d.queryKey(ctx, conn, fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY %s LIMIT 1 OFFSET %d",
+		d.pkList(), quoteName(d.table), where, d.pkList(), d.chunkSize-1), args)
+	if err != nil || upper != nil {
+		return upper, err
+	}
+
+	desc := make([]string, 0, len(d.pkColumns))
+	for _, c := range d.pkColumns {
+		desc = append(desc, quoteName(c)+" DESC")
+	}
+	return d.queryKey(ctx, conn, fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY %s LIMIT 1",
+		d.pkList(), quoteName(d.table), where, strings.Join(desc, ", ")), args)
+}
+
+// queryKey returns the primary key of the row of the query, or nil if there
+// is no row.
+func (d *tableDiffer) queryKey(ctx context.Context, conn *sql.Conn, query string,
+	args []interface{}) ([]interface{}, error) {
+	dest := make([]interface{}, len(d.pkColumns))
+	for i, kind := range d.pkKinds {
+		switch kind {
+		case pkInt:
+			dest[i] = new(int64)
+		case pkUint:
+			dest[i] = new(uint64)
+		default:
+			dest[i] = new(string)
+		}
+	}
+	err := conn.QueryRowContext(ctx, query, args...).Scan(dest...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := make([]interface{}, len(dest))
+	for i, v := range dest {
+		switch v := v.(type) {
+		case *int64:
+			key[i] = *v
+		case *uint64:
+			key[i] = *v
+		case *string:
+			key[i] = *v
+		}
+	}
+	return key, nil
+}
+
+// pkKind returns the kind of the values of the primary key column.
+func (d *tableDiffer) pkKind(ctx context.Context, column string) (pkKind, error) {
+	var dataType, columnType string
+	if err := d.upstream.QueryRowContext(ctx, `
+		SELECT DATA_TYPE, COLUMN_TYPE FROM information_schema.columns
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?
+	`, d.table, column).Scan(&dataType, &columnType); err != nil {
+		return pkString, err
+	}
+	switch strings.ToLower(dataType) {
+	case "tinyint", "smallint", "mediumint", "int", "bigint":
+		if strings.Contains(strings.ToLower(columnType), "unsigned") {
+			return pkUint, nil
+		}
+		return pkInt, nil
+	default:
+		return pkString, nil
+	}
+}
+
+// rangeCondition returns the condition of the primary key in (lower, upper],
+// the nil bound means unbounded.
+func (d *tableDiffer) rangeCondition(lower, upper []interface{}) (string, []interface{}) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(d.pkColumns)), ", ")
+
+	conditions := []string{"1 = 1"}
+	var args []interface{}
+	if lower != nil {
+		conditions = append(conditions, fmt.Sprintf("(%s) > (%s)", d.pkList(), placeholders))
+		args = append(args, lower...)
+	}
+	if upper != nil {
+		conditions = append(conditions, fmt.Sprintf("(%s) <= (%s)", d.pkList(), placeholders))
+		args = append(args, upper...)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// checksum returns the number of the rows and the checksum of the rows in the
+// range, which is the XOR of the CRC32 of each row.
+func (d *tableDiffer) checksum(ctx context.Context, conn *sql.Conn, where string,
+	args []interface{}) (int64, int64, error) {
+	// Each column is hashed on its own, so the separators can not appear in
+	// the hashed values, and the NULL values differ from the empty strings.
+	hashes := make([]string, 0, len(d.columns))
+	for _, c := range d.columns {
+		hashes = append(hashes, fmt.Sprintf("IFNULL(CRC32(%s), 'NULL')", quoteName(c)))
+	}
+	query := fmt.Sprintf(
+		"SELECT COUNT(*), IFNULL(BIT_XOR(CAST(CRC32(CONCAT_WS(',', %s)) AS UNSIGNED)), 0) FROM %s WHERE %s",
+		strings.Join(hashes, ", "), quoteName(d.table), where)
+
+	var count, sum int64
+	err := conn.QueryRowContext(ctx, query, args...).Scan(&count, &sum)
+	return count, sum, err
+}
+
+// diffRows compares the rows in the range one by one.
+func (d *tableDiffer) diffRows(ctx context.Context, where string, args []interface{}) ([]RowDiff, error) {
+	upRows, err := d.readRows(ctx, d.upstream, where, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s in the upstream: %v", d.table, err)
+	}
+	downRows, err := d.readRows(ctx, d.downstream, where, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s in the downstream: %v", d.table, err)
+	}
+
+	return d.compareRows(upRows, downRows), nil
+}
+
+// compareRows returns the different rows of the upstream and the downstream,
+// which are keyed by the primary key, in the order of the primary key.
+func (d *tableDiffer) compareRows(upRows, downRows map[string][]string) []RowDiff {
+	var diffs []RowDiff
+	for key, up := range upRows {
+		down, ok := downRows[key]
+		if !ok {
+			diffs = append(diffs, RowDiff{Kind: RowMissing, PK: d.pk(up)})
+			continue
+		}
+		var columns []string
+		for i, c := range d.columns {
+			if up[i] != down[i] {
+				columns = append(columns, c)
+			}
+		}
+		if len(columns) > 0 {
+			diffs = append(diffs, RowDiff{Kind: RowDifferent, PK: d.pk(up), Columns: columns})
+		}
+	}
+	for key, down := range downRows {
+		if _, ok := upRows[key]; !ok {
+			diffs = append(diffs, RowDiff{Kind: RowExtra, PK: d.pk(down)})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return strings.Join(diffs[i].PK, ",") < strings.Join(diffs[j].PK, ",")
+	})
+	return diffs
+}
+
+// readRows reads the rows in the range, keyed by the primary key.
+func (d *tableDiffer) readRows(ctx context.Context, conn *sql.Conn, where string,
+	args []interface{}) (map[string][]string, error) {
+	quoted := make([]string, 0, len(d.columns))
+	for _, c := range d.columns {
+		quoted = append(quoted, quoteName(c))
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(quoted, ", "), quoteName(d.table), where)
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string][]string)
+	for rows.Next() {
+		values := make([]sql.NullString, len(d.columns))
+		dest := make([]interface{}, len(values))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		row := make([]string, len(values))
+		for i, v := range values {
+			row[i] = nullValue
+			if v.Valid {
+				row[i] = v.String
+			}
+		}
+		result[d.rowKey(row)] = row
+	}
+	return result, rows.Err()
+}
+
+// pk returns the primary key values of the row.
+func (d *tableDiffer) pk(row []string) []string {
+	pk := make([]string, 0, len(d.pkColumns))
+	for _, pc := range d.pkColumns {
+		for i, c := range d.columns {
+			if c == pc {
+				pk = append(pk, row[i])
+			}
+		}
+	}
+	return pk
+}
+
+// rowKey returns the key of the row by the primary key.
+func (d *tableDiffer) rowKey(row []string) string {
+	return strings.Join(d.pk(row), "\x00")
+}
+
+func (d *tableDiffer) pkList() string {
+	quoted := make([]string, 0, len(d.pkColumns))
+	for _, c := range d.pkColumns {
+		quoted = append(quoted, quoteName(c))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func quoteName(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func queryStrings(ctx context.Context, conn *sql.Conn, query string, args ...interface{}) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRangeCondition(t *testing.T) {
+	tests := []struct {
+		name      string
+		pkColumns []string
+		lower     []interface{}
+		upper     []interface{}
+		where     string
+		args      []interface{}
+	}{
+		{
+			name:      "unbounded",
+			pkColumns: []string{"id"},
+			where:     "1 = 1",
+		},
+		{
+			name:      "first chunk",
+			pkColumns: []string{"id"},
+			upper:     []interface{}{int64(1000)},
+			where:     "1 = 1 AND (`id`) <= (?)",
+			args:      []interface{}{int64(1000)},
+		},
+		{
+			name:      "middle chunk",
+			pkColumns: []string{"id"},
+			lower:     []interface{}{int64(1000)},
+			upper:     []interface{}{uint64(9007199254740993)},
+			where:     "1 = 1 AND (`id`) > (?) AND (`id`) <= (?)",
+			args:      []interface{}{int64(1000), uint64(9007199254740993)},
+		},
+		{
+			name:      "composite key after the lower bound",
+			pkColumns: []string{"book_id", "user_id"},
+			lower:     []interface{}{int64(7), int64(42)},
+			where:     "1 = 1 AND (`book_id`, `user_id`) > (?, ?)",
+			args:      []interface{}{int64(7), int64(42)},
+		},
+	}
+
+	for _, tt := range tests {
+		d := &tableDiffer{pkColumns: tt.pkColumns}
+		where, args := d.rangeCondition(tt.lower, tt.upper)
+		if where != tt.where || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%s: rangeCondition = %q %v, want %q %v", tt.name, where, args, tt.where, tt.args)
+		}
+	}
+}
+
+func TestCompareRows(t *testing.T) {
+	d := &tableDiffer{
+		columns:   []string{"book_id", "score", "user_id", "note"},
+		pkColumns: []string{"book_id", "user_id"},
+	}
+	rows := func(rows ...[]string) map[string][]string {
+		result := make(map[string][]string)
+		for _, row := range rows {
+			result[d.rowKey(row)] = row
+		}
+		return result
+	}
+
+	tests := []struct {
+		name string
+		up   map[string][]string
+		down map[string][]string
+		want []RowDiff
+	}{
+		{
+			name: "same",
+			up:   rows([]string{"1", "5", "10", "a"}),
+			down: rows([]string{"1", "5", "10", "a"}),
+		},
+		{
+			name: "missing, extra and different",
+			up: rows(
+				[]string{"1", "5", "10", "a"},
+				[]string{"2", "3", "10", nullValue},
+				[]string{"3", "4", "10", ""},
+			),
+			down: rows(
+				[]string{"2", "4", "10", ""},
+				[]string{"3", "4", "10", ""},
+				[]string{"4", "1", "11", "b"},
+			),
+			want: []RowDiff{
+				{Kind: RowMissing, PK: []string{"1", "10"}},
+				{Kind: RowDifferent, PK: []string{"2", "10"}, Columns: []string{"score", "note"}},
+				{Kind: RowExtra, PK: []string{"4", "11"}},
+			},
+		},
+		{
+			name: "same book of different users",
+			up:   rows([]string{"1", "5", "10", "a"}),
+			down: rows([]string{"1", "5", "11", "a"}),
+			want: []RowDiff{
+				{Kind: RowMissing, PK: []string{"1", "10"}},
+				{Kind: RowExtra, PK: []string{"1", "11"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := d.compareRows(tt.up, tt.down); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: compareRows = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package db
+
+import "fmt"
+
+// ConnError is a failure of connecting to the database.
+type ConnError struct {
+	Err error
+}
+
+func (e *ConnError) Error() string {
+	return fmt.Sprintf("cannot connect to the database: %v", e.Err)
+}
+
+func (e *ConnError) Unwrap() error {
+	return e.Err
+}
+
+// LoadError is a failure of loading the data into a table.
+type LoadError struct {
+	Table string
+	Err   error
+}
+
+func (e *LoadError) Error() string {
+	return fmt.Sprintf("failed to load table %s: %v", e.Table, e.Err)
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// VerifyError is a failure of verifying the data, e.g. the tables of a replica
+// differ from the upstream.
+type VerifyError struct {
+	Reason string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("verification failed: %s", e.Reason)
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// ReadOptionFile reads the options of the group in the MySQL option file,
+// e.g. the [client] group of ~/.my.cnf. The option names are normalized with
+// dashes, e.g. ssl_ca is read as ssl-ca.
+func ReadOptionFile(path, group string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	options := make(map[string]string)
+	inGroup := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "", strings.HasPrefix(line, "#"), strings.HasPrefix(line, ";"), strings.HasPrefix(line, "!"):
+			// Skip the comments and the !include directives.
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			inGroup = strings.EqualFold(strings.TrimSpace(line[1:len(line)-1]), group)
+			continue
+		case !inGroup:
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		name := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(parts[0])), "_", "-")
+		value := ""
+		if len(parts) == 2 {
+			value = unquoteOption(strings.TrimSpace(parts[1]))
+		}
+		options[name] = value
+	}
+	return options, scanner.Err()
+}
+
+func unquoteOption(value string) string {
+	if len(value) >= 2 {
+		if q := value[0]; (q == '"' || q == '\'') && value[len(value)-1] == q {
+			return value[1 : len(value)-1]
+		}
+	}
+	return value
+}
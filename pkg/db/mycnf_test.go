@@ -0,0 +1,83 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadOptionFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		group   string
+		want    map[string]string
+	}{
+		{
+			name: "client group",
+			content: `# comment
+[mysqld]
+port = 3306
+
+[client]
+user = root
+password = "p@ss=word"
+ssl_ca = '/etc/ssl/ca.pem'
+; comment
+skip-ssl
+!includedir /etc/mysql/conf.d/
+
+[mysql]
+user = other
+`,
+			group: "client",
+			want: map[string]string{
+				"user":     "root",
+				"password": "p@ss=word",
+				"ssl-ca":   "/etc/ssl/ca.pem",
+				"skip-ssl": "",
+			},
+		},
+		{
+			name:    "case insensitive group",
+			content: "[ Client ]\nHost=tidb\n",
+			group:   "client",
+			want:    map[string]string{"host": "tidb"},
+		},
+		{
+			name:    "later options override",
+			content: "[client]\nport=4000\n[client]\nport=4001\n",
+			group:   "client",
+			want:    map[string]string{"port": "4001"},
+		},
+		{
+			name:    "no group",
+			content: "[mysqld]\nport=3306\n",
+			group:   "client",
+			want:    map[string]string{},
+		},
+	}
+
+	dir := t.TempDir()
+	for i, tt := range tests {
+		path := filepath.Join(dir, fmt.Sprintf("my%d.cnf", i))
+		if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadOptionFile(path, tt.group)
+		if err != nil {
+			t.Errorf("%s: ReadOptionFile failed: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ReadOptionFile = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := ReadOptionFile(filepath.Join(dir, "missing.cnf"), "client"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ReadOptionFile of a missing file = %v, want %v", err, os.ErrNotExist)
+	}
+}
@@ -0,0 +1,275 @@
+package db
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// SSL modes of the connections, the same as the --ssl-mode of the mysql client.
+const (
+	SSLModeDisabled       = "disabled"
+	SSLModePreferred      = "preferred"
+	SSLModeRequired       = "required"
+	SSLModeVerifyCA       = "verify-ca"
+	SSLModeVerifyIdentity = "verify-identity"
+)
+
+// SSLModes are the supported SSL modes.
+var SSLModes = []string{SSLModeDisabled, SSLModePreferred, SSLModeRequired, SSLModeVerifyCA, SSLModeVerifyIdentity}
+
+// tlsConfigName is the name of the TLS config registered into the driver.
+const tlsConfigName = "tidb-dataset"
+
+// ConnOptions are the options of connecting to the database.
+type ConnOptions struct {
+	// DSN is the data source name, e.g. "root:@tcp(127.0.0.1:4000)/bookshop",
+	// it takes the place of the host, the port, the socket and the user, and
+	// the database in it takes the place of DBName.
+	DSN string
+	// Host is the host, or the comma-separated hosts with the ports, e.g.
+	// "tidb1:4000,tidb2:4000", to whom the connections are balanced by the
+	// Balance policy.
+	Host     string
+	Port     int
+	Socket   string
+	User     string
+	Password string
+	DBName   string
+
+	// Balance is one of Balances, the default is round-robin.
+	Balance string
+
+	// SSLMode is one of SSLModes, the default is verify-ca with SSLCA,
+	// required with SSLCert, or preferred otherwise.
+	SSLMode string
+	SSLCA   string
+	SSLCert string
+	SSLKey  string
+
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// SessionVars are set on every connection, the values are used as they
+	// are in the SET statements.
+	SessionVars map[string]string
+}
+
+// ParseSessionVars parses the session variables in the form of k=v.
+func ParseSessionVars(vars []string) (map[string]string, error) {
+	result := make(map[string]string, len(vars))
+	for _, v := range vars {
+		parts := strings.SplitN(v, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || name == "" {
+			return nil, fmt.Errorf("invalid session variable %q, please use the form of name=value", v)
+		}
+		result[name] = strings.TrimSpace(parts[1])
+	}
+	return result, nil
+}
+
+// mysqlConfig returns the driver config of the options.
+func (o ConnOptions) mysqlConfig() (*mysql.Config, error) {
+	cfg := mysql.NewConfig()
+	if o.DSN != "" {
+		var err error
+		if cfg, err = mysql.ParseDSN(o.DSN); err != nil {
+			return nil, err
+		}
+		if cfg.DBName == "" {
+			cfg.DBName = o.DBName
+		}
+	} else {
+		cfg.User = o.User
+		cfg.Passwd = o.Password
+		cfg.DBName = o.DBName
+		if o.Socket != "" {
+			cfg.Net = "unix"
+			cfg.Addr = o.Socket
+		} else {
+			cfg.Net = "tcp"
+			cfg.Addr = o.addrs()[0]
+		}
+	}
+
+	tlsConfig, err := o.tlsConfigName()
+	if err != nil {
+		return nil, err
+	}
+	// The TLS config in the DSN is kept unless the SSL options are given.
+	if o.DSN == "" || cfg.TLSConfig == "" || o.SSLMode != "" || o.SSLCA != "" || o.SSLCert != "" {
+		cfg.TLSConfig = tlsConfig
+	}
+
+	if o.ConnectTimeout > 0 {
+		cfg.Timeout = o.ConnectTimeout
+	}
+	if o.ReadTimeout > 0 {
+		cfg.ReadTimeout = o.ReadTimeout
+	}
+	if o.WriteTimeout > 0 {
+		cfg.WriteTimeout = o.WriteTimeout
+	}
+
+	if len(o.SessionVars) > 0 {
+		if cfg.Params == nil {
+			cfg.Params = make(map[string]string, len(o.SessionVars))
+		}
+		// The driver sets the params other than the charset as the session
+		// variables when connecting.
+		for name, value := range o.SessionVars {
+			cfg.Params[name] = value
+		}
+	}
+	return cfg, nil
+}
+
+// addrs returns the addresses of the hosts.
+func (o ConnOptions) addrs() []string {
+	addrs := splitHosts(o.Host, o.Port)
+	if len(addrs) == 0 {
+		return []string{fmt.Sprintf("%s:%d", o.Host, o.Port)}
+	}
+	return addrs
+}
+
+// tlsConfigName returns the name of the TLS config of the SSL options, the
+// config with the certificates is registered into the driver.
+func (o ConnOptions) tlsConfigName() (string, error) {
+	mode := o.SSLMode
+	switch {
+	case mode != "":
+	case o.SSLCA != "":
+		mode = SSLModeVerifyCA
+	case o.SSLCert != "":
+		mode = SSLModeRequired
+	default:
+		mode = SSLModePreferred
+	}
+
+	hasFiles := o.SSLCA != "" || o.SSLCert != "" || o.SSLKey != ""
+	switch mode {
+	case SSLModeDisabled, SSLModePreferred:
+		if hasFiles {
+			return "", fmt.Errorf("the SSL certificates cannot be used with the %s SSL mode", mode)
+		}
+		if mode == SSLModeDisabled {
+			return "false", nil
+		}
+		return "preferred", nil
+	case SSLModeRequired, SSLModeVerifyCA, SSLModeVerifyIdentity:
+	default:
+		return "", fmt.Errorf("unknown SSL mode %s, use one of %s", mode, strings.Join(SSLModes, ", "))
+	}
+
+	if !hasFiles {
+		switch mode {
+		case SSLModeRequired:
+			return "skip-verify", nil
+		case SSLModeVerifyIdentity:
+			return "true", nil
+		}
+	}
+
+	tlsConfig, err := o.tlsConfig(mode)
+	if err != nil {
+		return "", err
+	}
+	if err := mysql.RegisterTLSConfig(tlsConfigName, tlsConfig); err != nil {
+		return "", err
+	}
+	return tlsConfigName, nil
+}
+
+func (o ConnOptions) tlsConfig(mode string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if o.SSLCA != "" {
+		pem, err := os.ReadFile(o.SSLCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the SSL CA: %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate is found in the SSL CA %s", o.SSLCA)
+		}
+	}
+
+	if o.SSLCert != "" || o.SSLKey != "" {
+		if o.SSLCert == "" || o.SSLKey == "" {
+			return nil, errors.New("the SSL cert and the SSL key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(o.SSLCert, o.SSLKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the SSL cert: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	switch mode {
+	case SSLModeRequired:
+		tlsConfig.InsecureSkipVerify = true
+	case SSLModeVerifyCA:
+		// The host name is not verified, so the chain is verified by hand.
+		tlsConfig.InsecureSkipVerify = true
+		roots := tlsConfig.RootCAs
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyChain(rawCerts, roots)
+		}
+	}
+	// The driver sets the server name to the host for verify-identity.
+	return tlsConfig, nil
+}
+
+// verifyChain verifies the certificate chain of the server without the host
+// name, the system roots are used if the roots are nil.
+func verifyChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return errors.New("no certificate is presented by the server")
+	}
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs = append(certs, cert)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	return err
+}
+
+// setPool applies the connection pool options to the database.
+func (o ConnOptions) setPool(db *sql.DB) {
+	if o.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(o.MaxOpenConns)
+	}
+	if o.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(o.MaxIdleConns)
+	}
+	if o.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(o.ConnMaxLifetime)
+	}
+	if o.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(o.ConnMaxIdleTime)
+	}
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// TableStats is the rows and the bytes of the INSERT statements written into
+// a table.
+type TableStats struct {
+	Table   string
+	Rows    int64
+	Bytes   int64
+	Batches int64
+}
+
+// ScriptWriter writes the statements into a SQL script instead of executing
+// them, and counts the rows and the bytes of the batches of each table.
+type ScriptWriter struct {
+	w io.Writer
+	// sampleRows limits the rows of the first batch of each table written
+	// into the script, the following batches are only counted. 0 means
+	// writing all the batches.
+	sampleRows int
+
+	tables []*TableStats
+	index  map[string]*TableStats
+	// omitted are the tables whose omitted rows are commented.
+	omitted map[string]bool
+}
+
+// NewScriptWriter creates the script writer, sampleRows limits the rows of
+// the batches written into the script, 0 means no limit.
+func NewScriptWriter(w io.Writer, sampleRows int) *ScriptWriter {
+	return &ScriptWriter{
+		w:          w,
+		sampleRows: sampleRows,
+		index:      make(map[string]*TableStats),
+		omitted:    make(map[string]bool),
+	}
+}
+
+// WriteStatement writes the statement terminated by a semicolon.
+func (s *ScriptWriter) WriteStatement(stmt string) error {
+	stmt = strings.TrimSpace(stmt)
+	if !strings.HasSuffix(stmt, ";") {
+		stmt += ";"
+	}
+	_, err := fmt.Fprintln(s.w, stmt)
+	return err
+}
+
+// WriteComment writes the comment line.
+func (s *ScriptWriter) WriteComment(format string, args ...interface{}) error {
+	_, err := fmt.Fprintf(s.w, "-- "+format+"\n", args...)
+	return err
+}
+
+// WriteBatch implements BatchWriter.
+func (s *ScriptWriter) WriteBatch(_ context.Context, table, insertHint string, values []string) error {
+	stats, ok := s.index[table]
+	if !ok {
+		stats = &TableStats{Table: table}
+		s.tables = append(s.tables, stats)
+		s.index[table] = stats
+	}
+	stats.Rows += int64(len(values))
+	stats.Bytes += int64(len(InsertStatement(insertHint, values)) + len(";\n"))
+	stats.Batches++
+
+	if s.sampleRows <= 0 {
+		return s.WriteStatement(InsertStatement(insertHint, values))
+	}
+	if stats.Batches == 1 {
+		sample := values
+		if len(sample) > s.sampleRows {
+			sample = sample[:s.sampleRows]
+		}
+		if err := s.WriteStatement(InsertStatement(insertHint, sample)); err != nil {
+			return err
+		}
+		if len(sample) == len(values) {
+			return nil
+		}
+	}
+	if s.omitted[table] {
+		return nil
+	}
+	s.omitted[table] = true
+	return s.WriteComment("... the other rows of %s are omitted", table)
+}
+
+// Stats returns the statistics of the tables in the order of writing.
+func (s *ScriptWriter) Stats() []TableStats {
+	stats := make([]TableStats, 0, len(s.tables))
+	for _, t := range s.tables {
+		stats = append(stats, *t)
+	}
+	return stats
+}
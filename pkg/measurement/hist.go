@@ -0,0 +1,95 @@
+package measurement
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+const (
+	// The latencies are recorded in microseconds between 1us and 5min.
+	minLatency = 1
+	maxLatency = int64(5 * time.Minute / time.Microsecond)
+	sigFigs    = 3
+)
+
+// Histogram records the latencies and the errors of an operation.
+type Histogram struct {
+	mu     sync.Mutex
+	hist   *hdrhistogram.Histogram
+	errors int64
+}
+
+func newHistogram() *Histogram {
+	return &Histogram{
+		hist: hdrhistogram.New(minLatency, maxLatency, sigFigs),
+	}
+}
+
+// Measure records the latency of a succeeded operation, or counts the error.
+func (h *Histogram) Measure(latency time.Duration, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err != nil {
+		h.errors++
+		return
+	}
+
+	us := latency.Microseconds()
+	if us < minLatency {
+		us = minLatency
+	} else if us > maxLatency {
+		us = maxLatency
+	}
+	// The value is always in the trackable range, so the error is ignored.
+	_ = h.hist.RecordValue(us)
+}
+
+// Stats returns the statistics of the histogram in the elapsed time.
+func (h *Histogram) Stats(operation string, elapsed time.Duration) OpStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	count := h.hist.TotalCount()
+	s := OpStats{
+		Operation: operation,
+		ElapsedS:  elapsed.Seconds(),
+		Count:     count,
+		Errors:    h.errors,
+		AvgMs:     h.hist.Mean() / 1000,
+		P50Ms:     float64(h.hist.ValueAtQuantile(50)) / 1000,
+		P95Ms:     float64(h.hist.ValueAtQuantile(95)) / 1000,
+		P99Ms:     float64(h.hist.ValueAtQuantile(99)) / 1000,
+		P999Ms:    float64(h.hist.ValueAtQuantile(99.9)) / 1000,
+		MaxMs:     float64(h.hist.Max()) / 1000,
+	}
+	if elapsed > 0 {
+		s.TPS = float64(count) / elapsed.Seconds()
+	}
+	return s
+}
+
+// OpStats is the statistics of an operation.
+type OpStats struct {
+	Operation string  `json:"operation"`
+	ElapsedS  float64 `json:"elapsed_s"`
+	Count     int64   `json:"count"`
+	Errors    int64   `json:"errors"`
+	TPS       float64 `json:"tps"`
+	AvgMs     float64 `json:"avg_ms"`
+	P50Ms     float64 `json:"p50_ms"`
+	P95Ms     float64 `json:"p95_ms"`
+	P99Ms     float64 `json:"p99_ms"`
+	P999Ms    float64 `json:"p999_ms"`
+	MaxMs     float64 `json:"max_ms"`
+}
+
+func (s OpStats) String() string {
+	return fmt.Sprintf("%-14s - Takes(s): %.1f, Count: %d, TPS: %.1f, Errors: %d, Avg(ms): %.1f, "+
+		"50th(ms): %.1f, 95th(ms): %.1f, 99th(ms): %.1f, 99.9th(ms): %.1f, Max(ms): %.1f",
+		s.Operation, s.ElapsedS, s.Count, s.TPS, s.Errors, s.AvgMs,
+		s.P50Ms, s.P95Ms, s.P99Ms, s.P999Ms, s.MaxMs)
+}
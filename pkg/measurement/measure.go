@@ -0,0 +1,137 @@
+package measurement
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Mini256/tidb-dataset/pkg/metrics"
+)
+
+// Measurement measures the operations of a workload, it keeps the histograms
+// of the current report interval and the summary of the whole run.
+type Measurement struct {
+	mu sync.Mutex
+
+	start        time.Time
+	currentStart time.Time
+	current      map[string]*Histogram
+	summary      map[string]*Histogram
+	timeline     *Timeline
+}
+
+// NewMeasurement creates a measurement starting from now.
+func NewMeasurement() *Measurement {
+	now := time.Now()
+	return &Measurement{
+		start:        now,
+		currentStart: now,
+		current:      make(map[string]*Histogram),
+		summary:      make(map[string]*Histogram),
+		timeline:     newTimeline(now),
+	}
+}
+
+// Reset drops all the measured operations and restarts from now.
+func (m *Measurement) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.start, m.currentStart = now, now
+	m.current = make(map[string]*Histogram)
+	m.summary = make(map[string]*Histogram)
+	m.timeline = newTimeline(now)
+}
+
+// ResetSummary drops the measured operations of the summary and the current
+// interval and restarts them from now, the timeline is kept, e.g. to keep the
+// warmup in the timeline of the run.
+func (m *Measurement) ResetSummary() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.start, m.currentStart = now, now
+	m.current = make(map[string]*Histogram)
+	m.summary = make(map[string]*Histogram)
+}
+
+// Measure records the latency or the error of an operation.
+func (m *Measurement) Measure(operation string, latency time.Duration, err error) {
+	m.mu.Lock()
+	current, ok := m.current[operation]
+	if !ok {
+		current = newHistogram()
+		m.current[operation] = current
+	}
+	summary, ok := m.summary[operation]
+	if !ok {
+		summary = newHistogram()
+		m.summary[operation] = summary
+	}
+	timeline := m.timeline
+	m.mu.Unlock()
+
+	current.Measure(latency, err)
+	summary.Measure(latency, err)
+	timeline.add(time.Now(), latency, err)
+	metrics.ObserveTxn(operation, latency, err)
+}
+
+// TakeCurrent returns the statistics of the current report interval, and
+// starts a new interval.
+func (m *Measurement) TakeCurrent() []OpStats {
+	m.mu.Lock()
+	current, start := m.current, m.currentStart
+	m.current, m.currentStart = make(map[string]*Histogram), time.Now()
+	m.mu.Unlock()
+
+	return stats(current, time.Since(start))
+}
+
+// Summary returns the statistics of the whole run.
+func (m *Measurement) Summary() []OpStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return stats(m.summary, time.Since(m.start))
+}
+
+// Timeline returns the per-second timeline of the operations since the last
+// reset.
+func (m *Measurement) Timeline() *Timeline {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.timeline
+}
+
+// Output prints the statistics of the current interval, or the summary.
+func (m *Measurement) Output(ifSummaryReport bool) {
+	if ifSummaryReport {
+		for _, s := range m.Summary() {
+			fmt.Printf("[Summary] %s\n", s)
+		}
+		return
+	}
+
+	for _, s := range m.TakeCurrent() {
+		fmt.Printf("[Current] %s\n", s)
+	}
+}
+
+func stats(histograms map[string]*Histogram, elapsed time.Duration) []OpStats {
+	operations := make([]string, 0, len(histograms))
+	for op := range histograms {
+		operations = append(operations, op)
+	}
+	sort.Strings(operations)
+
+	result := make([]OpStats, 0, len(operations))
+	for _, op := range operations {
+		result = append(result, histograms[op].Stats(op, elapsed))
+	}
+	return result
+}
@@ -0,0 +1,88 @@
+package measurement
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Report is the machine-readable summary of a run.
+type Report struct {
+	Dataset    string    `json:"dataset"`
+	StartedAt  time.Time `json:"started_at"`
+	Threads    int       `json:"threads"`
+	ElapsedS   float64   `json:"elapsed_s"`
+	Operations []OpStats `json:"operations"`
+	// Annotations are the events during the run, which are only written into
+	// the JSON report.
+	Annotations []Annotation `json:"annotations,omitempty"`
+	// Hosts are the throughput of each host when the connections are balanced
+	// to multiple hosts, which are only written into the JSON report.
+	Hosts []HostStats `json:"hosts,omitempty"`
+}
+
+// HostStats is the throughput of a database host in the run.
+type HostStats struct {
+	Host       string  `json:"host"`
+	Statements int64   `json:"statements"`
+	Errors     int64   `json:"errors"`
+	QPS        float64 `json:"qps"`
+	// Downs is the number of the times the host is marked down in the run.
+	Downs int64 `json:"downs"`
+}
+
+// WriteFile writes the report into the file, as CSV if the file has the .csv
+// extension, or as JSON otherwise.
+func (r *Report) WriteFile(path string) error {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return r.writeCSV(path)
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (r *Report) writeCSV(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	header := []string{
+		"dataset", "started_at", "threads", "operation", "elapsed_s", "count", "errors", "tps",
+		"avg_ms", "p50_ms", "p95_ms", "p99_ms", "p999_ms", "max_ms",
+	}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	formatFloat := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 3, 64)
+	}
+	for _, s := range r.Operations {
+		record := []string{
+			r.Dataset, r.StartedAt.Format(time.RFC3339), strconv.Itoa(r.Threads), s.Operation,
+			formatFloat(s.ElapsedS), strconv.FormatInt(s.Count, 10), strconv.FormatInt(s.Errors, 10),
+			formatFloat(s.TPS), formatFloat(s.AvgMs), formatFloat(s.P50Ms), formatFloat(s.P95Ms),
+			formatFloat(s.P99Ms), formatFloat(s.P999Ms), formatFloat(s.MaxMs),
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,126 @@
+package measurement
+
+import (
+	"sync"
+	"time"
+)
+
+// point is the throughput and the latency of all the operations in a second.
+type point struct {
+	count   int64
+	errors  int64
+	latency time.Duration
+	max     time.Duration
+}
+
+// Timeline keeps the throughput and the latency of all the operations in each
+// second, which is cheap enough to look back at any window of the run.
+type Timeline struct {
+	mu     sync.Mutex
+	start  time.Time
+	points []point
+}
+
+func newTimeline(start time.Time) *Timeline {
+	return &Timeline{start: start}
+}
+
+func (t *Timeline) add(now time.Time, latency time.Duration, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	i := int(now.Sub(t.start) / time.Second)
+	if i < 0 {
+		return
+	}
+	for len(t.points) <= i {
+		t.points = append(t.points, point{})
+	}
+	p := &t.points[i]
+	if err != nil {
+		p.errors++
+		return
+	}
+	p.count++
+	p.latency += latency
+	if latency > p.max {
+		p.max = latency
+	}
+}
+
+// WindowStats is the throughput and the latency of all the operations in a
+// time window.
+type WindowStats struct {
+	ElapsedS float64 `json:"elapsed_s"`
+	Count    int64   `json:"count"`
+	Errors   int64   `json:"errors"`
+	TPS      float64 `json:"tps"`
+	AvgMs    float64 `json:"avg_ms"`
+	MaxMs    float64 `json:"max_ms"`
+}
+
+// Window returns the statistics of the seconds in [from, to).
+func (t *Timeline) Window(from, to time.Time) WindowStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	first := int(from.Sub(t.start) / time.Second)
+	if first < 0 {
+		first = 0
+	}
+	last := int((to.Sub(t.start) + time.Second - 1) / time.Second)
+	if last > len(t.points) {
+		last = len(t.points)
+	}
+
+	var (
+		s          WindowStats
+		latency    time.Duration
+		maxLatency time.Duration
+	)
+	for i := first; i < last; i++ {
+		p := t.points[i]
+		s.Count += p.count
+		s.Errors += p.errors
+		latency += p.latency
+		if p.max > maxLatency {
+			maxLatency = p.max
+		}
+	}
+	if last > first {
+		s.ElapsedS = float64(last - first)
+		s.TPS = float64(s.Count) / s.ElapsedS
+	}
+	if s.Count > 0 {
+		s.AvgMs = float64(latency.Microseconds()) / float64(s.Count) / 1000
+	}
+	s.MaxMs = float64(maxLatency.Microseconds()) / 1000
+	return s
+}
+
+// Annotation marks an event of the run, e.g. a DDL, with the statistics of all
+// the operations before, during and after the event.
+type Annotation struct {
+	Name      string      `json:"name"`
+	Statement string      `json:"statement,omitempty"`
+	StartedAt time.Time   `json:"started_at"`
+	ElapsedS  float64     `json:"elapsed_s"`
+	Error     string      `json:"error,omitempty"`
+	Before    WindowStats `json:"before"`
+	During    WindowStats `json:"during"`
+	After     WindowStats `json:"after"`
+}
+
+// Annotate returns the annotation of the event in [start, end), which compares
+// the operations in the windows before and after the event.
+func (t *Timeline) Annotate(name, statement string, start, end time.Time, window time.Duration) Annotation {
+	return Annotation{
+		Name:      name,
+		Statement: statement,
+		StartedAt: start,
+		ElapsedS:  end.Sub(start).Seconds(),
+		Before:    t.Window(start.Add(-window), start),
+		During:    t.Window(start, end),
+		After:     t.Window(end, end.Add(window)),
+	}
+}
@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "tidb_dataset"
+
+var (
+	rowsInserted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rows_inserted_total",
+		Help:      "Number of rows inserted into each table.",
+	}, []string{"table"})
+
+	batchFlushDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "batch_flush_duration_seconds",
+		Help:      "Latency of flushing a batch of rows into each table.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 16),
+	}, []string{"table"})
+
+	sqlRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sql_retries_total",
+		Help:      "Number of retried statements by the MySQL error code.",
+	}, []string{"code"})
+
+	sqlErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sql_errors_total",
+		Help:      "Number of failed statements and transactions by the MySQL error code.",
+	}, []string{"code"})
+
+	txnDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "txn_duration_seconds",
+		Help:      "Latency of each transaction type in the run, the TPS is the rate of the count.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 18),
+	}, []string{"txn", "result"})
+)
+
+var mux = http.NewServeMux()
+
+// Handle registers the handler on the metrics server.
+func Handle(pattern string, handler http.Handler) {
+	mux.Handle(pattern, handler)
+}
+
+// Serve starts the metrics server on the address, the metrics are exposed
+// at the /metrics path.
+func Serve(addr string) error {
+	mux.Handle("/metrics", promhttp.Handler())
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return server.ListenAndServe()
+}
+
+// RegisterDB exposes the connection statistics of the database.
+func RegisterDB(db *sql.DB) {
+	states := map[string]func(sql.DBStats) int{
+		"open":   func(s sql.DBStats) int { return s.OpenConnections },
+		"in_use": func(s sql.DBStats) int { return s.InUse },
+		"idle":   func(s sql.DBStats) int { return s.Idle },
+	}
+	for state, value := range states {
+		value := value
+		gauge := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "connections",
+			Help:        "Number of the database connections in each state.",
+			ConstLabels: prometheus.Labels{"state": state},
+		}, func() float64 {
+			return float64(value(db.Stats()))
+		})
+		if err := prometheus.Register(gauge); err != nil {
+			var registered prometheus.AlreadyRegisteredError
+			if !errors.As(err, &registered) {
+				panic(err)
+			}
+		}
+	}
+}
+
+// ObserveFlush records a batch of rows flushed into the table.
+func ObserveFlush(table string, rows int, latency time.Duration, err error) {
+	if err != nil {
+		return
+	}
+	rowsInserted.WithLabelValues(table).Add(float64(rows))
+	batchFlushDuration.WithLabelValues(table).Observe(latency.Seconds())
+}
+
+// ObserveRetry records a statement retried after the error.
+func ObserveRetry(err error) {
+	sqlRetries.WithLabelValues(errorCode(err)).Inc()
+}
+
+// ObserveError records a failed statement or transaction.
+func ObserveError(err error) {
+	sqlErrors.WithLabelValues(errorCode(err)).Inc()
+}
+
+// ObserveTxn records the latency or the error of a transaction.
+func ObserveTxn(txn string, latency time.Duration, err error) {
+	if err != nil {
+		ObserveError(err)
+		txnDuration.WithLabelValues(txn, "error").Observe(latency.Seconds())
+		return
+	}
+	txnDuration.WithLabelValues(txn, "ok").Observe(latency.Seconds())
+}
+
+// errorCode returns the MySQL error code of the error, or "unknown" for the
+// errors not from the server.
+func errorCode(err error) string {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return strconv.Itoa(int(mysqlErr.Number))
+	}
+	return "unknown"
+}
@@ -0,0 +1,41 @@
+package query
+
+// Comparison is the difference of a query between two reports.
+type Comparison struct {
+	Name string
+	// Old and New are nil if the query is missing in the report.
+	Old *QueryReport
+	New *QueryReport
+	// LatencyChange is the ratio of the latency change, e.g. 0.2 means the
+	// new latency is 20% higher than the old one.
+	LatencyChange float64
+	PlanChanged   bool
+	Regressed     bool
+}
+
+// Compare compares the queries of the two reports, a query is regressed if
+// its latency increases more than the threshold ratio.
+func Compare(oldReport, newReport *Report, threshold float64) []Comparison {
+	var comparisons []Comparison
+
+	for i := range oldReport.Queries {
+		old := &oldReport.Queries[i]
+		c := Comparison{Name: old.Name, Old: old, New: newReport.Get(old.Name)}
+		if c.New != nil {
+			if old.LatencyMs > 0 {
+				c.LatencyChange = (c.New.LatencyMs - old.LatencyMs) / old.LatencyMs
+			}
+			c.PlanChanged = old.PlanChanged(c.New)
+			c.Regressed = c.LatencyChange > threshold
+		}
+		comparisons = append(comparisons, c)
+	}
+
+	for i := range newReport.Queries {
+		if oldReport.Get(newReport.Queries[i].Name) == nil {
+			comparisons = append(comparisons, Comparison{Name: newReport.Queries[i].Name, New: &newReport.Queries[i]})
+		}
+	}
+
+	return comparisons
+}
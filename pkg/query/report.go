@@ -0,0 +1,141 @@
+package query
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Report is the plans and latencies of the queries captured in a run.
+type Report struct {
+	Dataset       string        `json:"dataset"`
+	ServerVersion string        `json:"server_version"`
+	CreatedAt     time.Time     `json:"created_at"`
+	Queries       []QueryReport `json:"queries"`
+}
+
+// QueryReport is the plan and latency of a query.
+type QueryReport struct {
+	Name string `json:"name"`
+	SQL  string `json:"sql"`
+	// LatencyMs is the latency of the query in milliseconds.
+	LatencyMs float64 `json:"latency_ms"`
+	// PlanDigest is the plan digest of TiDB in the statements summary, it is
+	// empty for the other databases or if the statements summary is disabled.
+	PlanDigest string `json:"plan_digest,omitempty"`
+	// ShapeDigest is the digest of the plan shape, it changes only when the
+	// operators, tasks or access objects of the plan change.
+	ShapeDigest string   `json:"shape_digest"`
+	PlanShape   []string `json:"plan_shape"`
+	Plan        *Result  `json:"plan"`
+}
+
+// NewQueryReport creates the report of the query from its result, the plan
+// digest of TiDB and the EXPLAIN ANALYZE output.
+func NewQueryReport(name, sql string, result *Result, planDigest string, plan *Result) QueryReport {
+	shape := PlanShape(plan)
+	digest := sha256.Sum256([]byte(strings.Join(shape, "\n")))
+
+	return QueryReport{
+		Name:        name,
+		SQL:         sql,
+		LatencyMs:   float64(result.Elapsed) / float64(time.Millisecond),
+		PlanDigest:  planDigest,
+		ShapeDigest: hex.EncodeToString(digest[:]),
+		PlanShape:   shape,
+		Plan:        plan,
+	}
+}
+
+// PlanChanged tells whether the plan of the query differs from the other
+// report, by the plan digests of TiDB if both have them, or else by the
+// digests of the plan shapes.
+func (q *QueryReport) PlanChanged(other *QueryReport) bool {
+	if q.PlanDigest != "" && other.PlanDigest != "" {
+		return q.PlanDigest != other.PlanDigest
+	}
+	return q.ShapeDigest != other.ShapeDigest
+}
+
+// Get returns the report of the query, or nil if not found.
+func (r *Report) Get(name string) *QueryReport {
+	for i := range r.Queries {
+		if r.Queries[i].Name == name {
+			return &r.Queries[i]
+		}
+	}
+	return nil
+}
+
+// WriteFile writes the report as JSON into the file.
+func (r *Report) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// ReadReport reads the JSON report from the file.
+func ReadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Report{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+var (
+	// operatorIDSuffix matches the numeric suffix of the TiDB operator ids,
+	// e.g. the "_12" in "HashJoin_12".
+	operatorIDSuffix = regexp.MustCompile(`_\d+`)
+	// planStatistics matches the cost, rows and actual time annotations in
+	// the tree plans of MySQL, e.g. "(cost=1.25 rows=10)".
+	planStatistics = regexp.MustCompile(`\s*\((?:cost|rows|actual time)=[^)]*\)|\s*\(never executed\)`)
+)
+
+// PlanShape returns the shape of the plan, which excludes the statistics and
+// execution information varying between the runs.
+func PlanShape(plan *Result) []string {
+	idCol, taskCol, objectCol := -1, -1, -1
+	for i, col := range plan.Columns {
+		switch strings.ToLower(col) {
+		case "id":
+			idCol = i
+		case "task":
+			taskCol = i
+		case "access object":
+			objectCol = i
+		}
+	}
+
+	shape := make([]string, 0, len(plan.Rows))
+	for _, row := range plan.Rows {
+		if idCol < 0 {
+			// Not a TiDB plan, e.g. the tree format of MySQL.
+			for _, line := range strings.Split(row[0], "\n") {
+				shape = append(shape, strings.TrimRight(planStatistics.ReplaceAllString(line, ""), " "))
+			}
+			continue
+		}
+
+		fields := []string{operatorIDSuffix.ReplaceAllString(row[idCol], "")}
+		if taskCol >= 0 {
+			fields = append(fields, row[taskCol])
+		}
+		if objectCol >= 0 {
+			fields = append(fields, row[objectCol])
+		}
+		shape = append(shape, strings.Join(fields, " | "))
+	}
+	return shape
+}
@@ -0,0 +1,111 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlanShape(t *testing.T) {
+	tests := []struct {
+		name string
+		plan *Result
+		want []string
+	}{
+		{
+			name: "tidb",
+			plan: &Result{
+				Columns: []string{"id", "estRows", "actRows", "task", "access object", "execution info"},
+				Rows: [][]string{
+					{"HashJoin_12", "10.00", "8", "root", "", "time:1.2ms, loops:2"},
+					{"├─TableReader_15(Build)", "10.00", "8", "root", "", "time:0.5ms"},
+					{"│ └─TableFullScan_14", "10.00", "8", "cop[tikv]", "table:books", "tikv_task:{time:0s}"},
+					{"└─IndexLookUp_20(Probe)", "1.00", "1", "root", "", "time:0.4ms"},
+				},
+			},
+			want: []string{
+				"HashJoin | root | ",
+				"├─TableReader(Build) | root | ",
+				"│ └─TableFullScan | cop[tikv] | table:books",
+				"└─IndexLookUp(Probe) | root | ",
+			},
+		},
+		{
+			name: "tidb without the access object",
+			plan: &Result{
+				Columns: []string{"ID", "Task"},
+				Rows:    [][]string{{"Point_Get_1", "root"}},
+			},
+			want: []string{"Point_Get | root"},
+		},
+		{
+			name: "mysql tree",
+			plan: &Result{
+				Columns: []string{"EXPLAIN"},
+				Rows: [][]string{{
+					"-> Limit: 10 row(s)  (cost=1.25 rows=10) (actual time=0.05..0.06 rows=10 loops=1)\n" +
+						"    -> Nested loop inner join  (cost=4.50 rows=10) (actual time=0.05..0.10 rows=10 loops=1)\n" +
+						"        -> Filter: (t1.stock > 10)  (cost=1.25 rows=3) (actual time=0.04..0.05 rows=3 loops=1)\n" +
+						"            -> Table scan on t1  (cost=1.25 rows=10) (actual time=0.04..0.05 rows=10 loops=1)\n" +
+						"        -> Index lookup on t2 using idx_2 (book_id=t1.id)  (cost=0.25 rows=1) (never executed)",
+				}},
+			},
+			want: []string{
+				"-> Limit: 10 row(s)",
+				"    -> Nested loop inner join",
+				"        -> Filter: (t1.stock > 10)",
+				"            -> Table scan on t1",
+				"        -> Index lookup on t2 using idx_2 (book_id=t1.id)",
+			},
+		},
+		{
+			name: "empty",
+			plan: &Result{Columns: []string{"id", "task"}},
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := PlanShape(tt.plan); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: PlanShape() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPlanChanged(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new QueryReport
+		want     bool
+	}{
+		{
+			name: "same plan digest with different shapes",
+			old:  QueryReport{PlanDigest: "a1", ShapeDigest: "s1"},
+			new:  QueryReport{PlanDigest: "a1", ShapeDigest: "s2"},
+			want: false,
+		},
+		{
+			name: "different plan digests",
+			old:  QueryReport{PlanDigest: "a1", ShapeDigest: "s1"},
+			new:  QueryReport{PlanDigest: "a2", ShapeDigest: "s1"},
+			want: true,
+		},
+		{
+			name: "no plan digest",
+			old:  QueryReport{ShapeDigest: "s1"},
+			new:  QueryReport{PlanDigest: "a1", ShapeDigest: "s1"},
+			want: false,
+		},
+		{
+			name: "different shapes without plan digests",
+			old:  QueryReport{ShapeDigest: "s1"},
+			new:  QueryReport{ShapeDigest: "s2"},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.old.PlanChanged(&tt.new); got != tt.want {
+			t.Errorf("%s: PlanChanged() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
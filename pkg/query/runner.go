@@ -0,0 +1,91 @@
+package query
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Result is the result of an executed query.
+type Result struct {
+	Columns []string      `json:"columns"`
+	Rows    [][]string    `json:"rows"`
+	Elapsed time.Duration `json:"-"`
+}
+
+// Run executes the query and reads all the result rows.
+func Run(ctx context.Context, conn *sql.Conn, query string) (*Result, error) {
+	start := time.Now()
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Result{Columns: columns}
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		row := make([]string, len(columns))
+		for i, v := range values {
+			if v.Valid {
+				row[i] = v.String
+			} else {
+				row[i] = "NULL"
+			}
+		}
+		r.Rows = append(r.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	r.Elapsed = time.Since(start)
+
+	return r, nil
+}
+
+// ExplainAnalyze executes the query with EXPLAIN ANALYZE and returns the plan.
+func ExplainAnalyze(ctx context.Context, conn *sql.Conn, query string) (*Result, error) {
+	return Run(ctx, conn, "EXPLAIN ANALYZE "+query)
+}
+
+// PlanDigest returns the plan digest of the latest execution of the query in
+// the statements summary of TiDB, or empty if it is not found, e.g. the
+// statements summary is disabled.
+func PlanDigest(ctx context.Context, conn *sql.Conn, query string) (string, error) {
+	var digest string
+	err := conn.QueryRowContext(ctx, `
+		SELECT PLAN_DIGEST FROM information_schema.statements_summary
+		WHERE QUERY_SAMPLE_TEXT = ? ORDER BY LAST_SEEN DESC LIMIT 1
+	`, query).Scan(&digest)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return digest, err
+}
+
+// Print prints the result rows as a table.
+func (r *Result) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(r.Columns, "\t"))
+	for _, row := range r.Rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,42 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const progressBarWidth = 40
+
+// ProgressBar prints the progress in a single line, which is redrawn on
+// every update.
+type ProgressBar struct {
+	w     io.Writer
+	title string
+}
+
+// NewProgressBar creates a progress bar printed to the writer.
+func NewProgressBar(w io.Writer, title string) *ProgressBar {
+	return &ProgressBar{
+		w:     w,
+		title: title,
+	}
+}
+
+// Update redraws the progress bar, the progress is between 0 and 1.
+func (p *ProgressBar) Update(progress float64, status string) {
+	if progress < 0 {
+		progress = 0
+	} else if progress > 1 {
+		progress = 1
+	}
+
+	done := int(progress * progressBarWidth)
+	fmt.Fprintf(p.w, "\r%s [%s%s] %5.1f%% %s", p.title,
+		strings.Repeat("#", done), strings.Repeat("-", progressBarWidth-done), progress*100, status)
+}
+
+// Finish ends the line of the progress bar.
+func (p *ProgressBar) Finish() {
+	fmt.Fprintln(p.w)
+}
@@ -0,0 +1,48 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate is the number of events per second, which is given as a flag like
+// 100/s, 30/m or 5/h, or a plain number per second.
+type Rate float64
+
+func (r *Rate) String() string {
+	return strconv.FormatFloat(float64(*r), 'f', -1, 64) + "/s"
+}
+
+// Set parses the rate.
+func (r *Rate) Set(value string) error {
+	count, unit := value, "s"
+	if i := strings.LastIndex(value, "/"); i >= 0 {
+		count, unit = value[:i], value[i+1:]
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(count), 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid rate %q, e.g. 100/s, 30/m or 5/h", value)
+	}
+
+	var per time.Duration
+	switch strings.TrimSpace(unit) {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return fmt.Errorf("invalid unit of rate %q, available: s, m, h", value)
+	}
+
+	*r = Rate(n * float64(time.Second) / float64(per))
+	return nil
+}
+
+func (r *Rate) Type() string {
+	return "rate"
+}
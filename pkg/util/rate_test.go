@@ -0,0 +1,41 @@
+package util
+
+import "testing"
+
+func TestRateSet(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Rate
+		err   bool
+	}{
+		{value: "100", want: 100},
+		{value: "100/s", want: 100},
+		{value: "30/m", want: 0.5},
+		{value: "36/h", want: 0.01},
+		{value: " 2.5 / s ", want: 2.5},
+		{value: "0", want: 0},
+		{value: "-1/s", err: true},
+		{value: "abc/s", err: true},
+		{value: "/s", err: true},
+		{value: "10/d", err: true},
+		{value: "10/", err: true},
+	}
+
+	for _, tt := range tests {
+		var r Rate
+		err := r.Set(tt.value)
+		if tt.err {
+			if err == nil {
+				t.Errorf("Set(%q) = %s, want an error", tt.value, r.String())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Set(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if diff := float64(r - tt.want); diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("Set(%q) = %s, want %s", tt.value, r.String(), tt.want.String())
+		}
+	}
+}
@@ -1,13 +1,20 @@
 package util
 
-type UInt32 map[uint32]struct{}
+import "sort"
+
+type Int64 map[int64]struct{}
 
 type String map[string]struct{}
 
-func UInt32Set2Arr(set UInt32) []uint32 {
-	arr := make([]uint32, 0, len(set))
+// Int64Set2Arr returns the sorted items of the set, so that the items are
+// picked in the same order by the same random numbers.
+func Int64Set2Arr(set Int64) []int64 {
+	arr := make([]int64, 0, len(set))
 	for item := range set {
 		arr = append(arr, item)
 	}
+	sort.Slice(arr, func(i, j int) bool {
+		return arr[i] < arr[j]
+	})
 	return arr
 }
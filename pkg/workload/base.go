@@ -3,6 +3,8 @@ package workload
 import (
 	"context"
 	"database/sql"
+
+	"github.com/Mini256/tidb-dataset/pkg/db"
 )
 
 // DatasetState saves state for each thread
@@ -21,19 +23,19 @@ func (t *DatasetState) RefreshConn(ctx context.Context) error {
 }
 
 // NewDatasetState creates a base DatasetState
-func NewDatasetState(ctx context.Context, db *sql.DB) *DatasetState {
+func NewDatasetState(ctx context.Context, sqlDB *sql.DB) (*DatasetState, error) {
 	var conn *sql.Conn
 	var err error
-	if db != nil {
-		conn, err = db.Conn(ctx)
+	if sqlDB != nil {
+		conn, err = sqlDB.Conn(ctx)
 		if err != nil {
-			panic(err.Error())
+			return nil, &db.ConnError{Err: err}
 		}
 	}
 
 	s := &DatasetState{
-		DB:   db,
+		DB:   sqlDB,
 		Conn: conn,
 	}
-	return s
+	return s, nil
 }
@@ -0,0 +1,57 @@
+package workload
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DDLStep is a DDL statement executed at the offset into the run.
+type DDLStep struct {
+	Name string        `yaml:"name"`
+	At   time.Duration `yaml:"at"`
+	SQL  string        `yaml:"sql"`
+}
+
+// DDLScript is the schedule of the DDL statements during the run.
+type DDLScript struct {
+	Steps []DDLStep `yaml:"steps"`
+}
+
+// LoadDDLScript loads the DDL script from the YAML file, the steps are sorted
+// by the offsets.
+func LoadDDLScript(path string) (*DDLScript, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &DDLScript{}
+	if err := yaml.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse DDL script %s: %v", path, err)
+	}
+	if len(s.Steps) == 0 {
+		return nil, fmt.Errorf("DDL script %s: no steps", path)
+	}
+	for i := range s.Steps {
+		step := &s.Steps[i]
+		step.SQL = strings.TrimSpace(step.SQL)
+		if step.SQL == "" {
+			return nil, fmt.Errorf("DDL script %s: step %d has no sql", path, i+1)
+		}
+		if step.At < 0 {
+			return nil, fmt.Errorf("DDL script %s: step %d has a negative offset", path, i+1)
+		}
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("ddl-%d", i+1)
+		}
+	}
+	sort.SliceStable(s.Steps, func(i, j int) bool {
+		return s.Steps[i].At < s.Steps[j].At
+	})
+	return s, nil
+}
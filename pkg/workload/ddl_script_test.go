@@ -0,0 +1,70 @@
+package workload
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadDDLScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []DDLStep
+		err     bool
+	}{
+		{
+			name: "sorted by the offsets",
+			content: `steps:
+  - name: add-index
+    at: 1m
+    sql: |
+      ALTER TABLE orders ADD INDEX idx_ordered_at (ordered_at);
+  - at: 30s
+    sql: "  ALTER TABLE books ADD COLUMN note varchar(100)  "
+  - name: drop-index
+    at: 1m
+    sql: ALTER TABLE orders DROP INDEX idx_ordered_at
+`,
+			want: []DDLStep{
+				{Name: "ddl-2", At: 30 * time.Second, SQL: "ALTER TABLE books ADD COLUMN note varchar(100)"},
+				{Name: "add-index", At: time.Minute, SQL: "ALTER TABLE orders ADD INDEX idx_ordered_at (ordered_at);"},
+				{Name: "drop-index", At: time.Minute, SQL: "ALTER TABLE orders DROP INDEX idx_ordered_at"},
+			},
+		},
+		{name: "no steps", content: "steps: []\n", err: true},
+		{name: "no sql", content: "steps:\n  - name: empty\n    at: 1s\n    sql: \" \"\n", err: true},
+		{name: "negative offset", content: "steps:\n  - at: -1s\n    sql: SELECT 1\n", err: true},
+		{name: "invalid offset", content: "steps:\n  - at: soon\n    sql: SELECT 1\n", err: true},
+		{name: "invalid yaml", content: "steps: [\n", err: true},
+	}
+
+	dir := t.TempDir()
+	for i, tt := range tests {
+		path := filepath.Join(dir, fmt.Sprintf("ddl%d.yaml", i))
+		if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		s, err := LoadDDLScript(path)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: LoadDDLScript = %+v, want an error", tt.name, s.Steps)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: LoadDDLScript failed: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(s.Steps, tt.want) {
+			t.Errorf("%s: LoadDDLScript = %+v, want %+v", tt.name, s.Steps, tt.want)
+		}
+	}
+
+	if _, err := LoadDDLScript(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Errorf("LoadDDLScript of a missing file succeeded, want an error")
+	}
+}
@@ -0,0 +1,68 @@
+package workload
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Profile is a mix of the transactions of the run workload.
+type Profile struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	// Weights is the relative weight of each transaction type.
+	Weights map[string]int `yaml:"weights"`
+	// ThinkTime is the pause of each thread after a transaction.
+	ThinkTime time.Duration `yaml:"think_time"`
+	// Skew is the exponent of the Zipfian distribution of the accessed rows,
+	// which must be greater than 1, or 0 for the uniform distribution.
+	Skew float64 `yaml:"skew"`
+}
+
+// LoadProfile loads the custom profile from the YAML file.
+func LoadProfile(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Profile{}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("failed to parse profile %s: %v", path, err)
+	}
+	if p.Name == "" {
+		p.Name = path
+	}
+	return p, nil
+}
+
+// Validate checks the profile only refers to the known transaction types.
+func (p *Profile) Validate(txns []string) error {
+	total := 0
+	for name, weight := range p.Weights {
+		known := false
+		for _, txn := range txns {
+			known = known || txn == name
+		}
+		if !known {
+			return fmt.Errorf("profile %s: unknown transaction type %s, available: %v", p.Name, name, txns)
+		}
+		if weight < 0 {
+			return fmt.Errorf("profile %s: negative weight of transaction type %s", p.Name, name)
+		}
+		total += weight
+	}
+	if total == 0 {
+		return fmt.Errorf("profile %s: the total weight of the transactions must be positive", p.Name)
+	}
+
+	if p.ThinkTime < 0 {
+		return fmt.Errorf("profile %s: negative think time", p.Name)
+	}
+	if p.Skew != 0 && p.Skew <= 1 {
+		return fmt.Errorf("profile %s: the skew must be greater than 1, or 0 for uniform access", p.Name)
+	}
+	return nil
+}
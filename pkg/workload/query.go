@@ -0,0 +1,23 @@
+package workload
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Query is a named query shipped with the dataset.
+type Query struct {
+	Name        string
+	Description string
+	// Tables is the tables or the aliases of the tables read by the query,
+	// which are used in the read_from_storage hint.
+	Tables []string
+	SQL    string
+}
+
+// WithStorageHint returns the query reading the tables from the TiDB storage
+// engine, tikv or tiflash.
+func (q Query) WithStorageHint(engine string) string {
+	hint := fmt.Sprintf("SELECT /*+ read_from_storage(%s[%s]) */", engine, strings.Join(q.Tables, ", "))
+	return strings.Replace(q.SQL, "SELECT", hint, 1)
+}
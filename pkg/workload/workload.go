@@ -1,14 +1,25 @@
 package workload
 
-import "context"
+import (
+	"context"
+
+	"github.com/Mini256/tidb-dataset/pkg/measurement"
+)
 
 // Workloader is the interface for running customized workload.
 type Workloader interface {
 	Name() string
 	DBName() string
-	InitThread(ctx context.Context) context.Context
+	// InitThread initializes the state of a thread, e.g. the connection.
+	InitThread(ctx context.Context) (context.Context, error)
 	CleanupThread(ctx context.Context)
 	Prepare(ctx context.Context) error
+	// InitRun initializes the state shared by the threads before running.
+	InitRun(ctx context.Context) error
+	// Run executes and measures a transaction of the workload.
 	Run(ctx context.Context) error
 	Cleanup(ctx context.Context) error
+	Queries() []Query
+	Profiles() []Profile
+	Measurement() *measurement.Measurement
 }